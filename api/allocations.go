@@ -18,6 +18,19 @@ var (
 	// NodeDownErr marks an operation as not able to complete since the node is
 	// down.
 	NodeDownErr = fmt.Errorf("node down")
+
+	// ErrNodeAddrNotAdvertised marks an operation as not able to complete
+	// because the node hasn't advertised an HTTP address yet. This is
+	// expected briefly in the window right after an allocation is placed,
+	// before the node has registered its address with the server.
+	ErrNodeAddrNotAdvertised = fmt.Errorf("node address not advertised")
+
+	// ErrAllocationGCd marks a filesystem operation as not able to complete
+	// because the allocation's files have already been garbage collected
+	// from the node. This is distinct from a generic 404: it means the
+	// allocation ran and completed (or failed), rather than never having
+	// existed on the node or the node being temporarily unreachable.
+	ErrAllocationGCd = fmt.Errorf("allocation files garbage collected")
 )
 
 const (
@@ -15,11 +15,13 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	cleanhttp "github.com/hashicorp/go-cleanhttp"
 	rootcerts "github.com/hashicorp/go-rootcerts"
+	"golang.org/x/net/http2"
 )
 
 var (
@@ -27,12 +29,24 @@ var (
 	// client directly before switching to a connection through the Nomad
 	// server.
 	ClientConnTimeout = 1 * time.Second
+
+	// ErrPermissionDenied marks a request as having been rejected with an
+	// HTTP 403, almost always because the ACL token in use lacks a
+	// required capability for the namespace or resource involved. The
+	// response body, which commonly names the missing capability, is
+	// included in the wrapping error's message so callers that don't
+	// unwrap it still see the detail.
+	ErrPermissionDenied = fmt.Errorf("permission denied")
 )
 
 const (
 	// AllNamespacesNamespace is a sentinel Namespace value to indicate that api should search for
 	// jobs and allocations in all the namespaces the requester can access.
 	AllNamespacesNamespace = "*"
+
+	// defaultUserAgent is the User-Agent header value sent on requests when
+	// Config.UserAgent is unset.
+	defaultUserAgent = "nomad-api-go"
 )
 
 // QueryOptions are used to parametrize a query
@@ -65,6 +79,87 @@ type QueryOptions struct {
 	// AuthToken is the secret ID of an ACL token
 	AuthToken string
 
+	// RetryableStatusCodes lists HTTP status codes that should be retried,
+	// up to retryableStatusMaxAttempts times, instead of being returned to
+	// the caller as an error immediately. This is useful for requests
+	// against client filesystem endpoints, which can transiently 502/503
+	// while a node is registering.
+	RetryableStatusCodes []int
+
+	// AllowDownNode skips the node status check GetNodeClient and
+	// GetNodeClientWithTimeout normally perform, letting the caller attempt
+	// to dial a node reported as down or disconnected anyway. This is
+	// useful for callers that would rather see the dial itself fail (or
+	// succeed, if the status is merely stale) than be stopped early.
+	AllowDownNode bool
+
+	// NodeStartupTimeout bounds how long a client filesystem request (such
+	// as AllocFS.List or AllocFS.Cat) will keep retrying, with backoff,
+	// when it looks like it's hitting the transient window right after an
+	// allocation is placed: the node hasn't advertised an HTTP address yet
+	// (ErrNodeAddrNotAdvertised), or the requested path 404s. Zero disables
+	// this retry and fails on the first such error, which remains the
+	// default so existing callers see no behavior change.
+	NodeStartupTimeout time.Duration
+
+	// ConnectRetryStatusCodes lists HTTP status codes that AllocFS.Stream
+	// should retry, with backoff, while establishing its initial
+	// connection -- for example a 503 while a node is mid-reload. It only
+	// governs that initial connect; once the stream is established,
+	// transient failures are Stream's own follow/reconnect logic's
+	// responsibility, not this one's. Zero value (nil) disables connect
+	// retry, same as leaving ConnectRetryMaxDuration unset.
+	ConnectRetryStatusCodes []int
+
+	// ConnectRetryMaxDuration bounds how long Stream's initial-connect
+	// retry (governed by ConnectRetryStatusCodes) keeps backing off before
+	// giving up and returning the last error. Zero disables the retry.
+	ConnectRetryMaxDuration time.Duration
+
+	// SetupTimeout bounds how long AllocFS.Stream's setup phase -- the node
+	// lookup plus establishing the connection, including any
+	// ConnectRetryMaxDuration backoff -- is allowed to take before Stream
+	// gives up and returns an *ErrStreamSetupTimeout, instead of blocking
+	// indefinitely before ever handing back a channel. It's a bound on
+	// getting the stream established, separate from the stream's ongoing
+	// lifetime once connected; see StreamWithMaxDuration for bounding that.
+	// Zero disables the bound, which remains the default so existing
+	// callers see no behavior change.
+	SetupTimeout time.Duration
+
+	// DetectContentType tells AllocFS.Stat to also read the first 512
+	// bytes of the file and populate AllocFileInfo.ContentType with
+	// http.DetectContentType's guess. This costs an extra round trip, so
+	// it's opt-in rather than the default for every Stat call.
+	DetectContentType bool
+
+	// IncludeFullPath tells AllocFS.List and AllocFS.ListRecursive to
+	// populate AllocFileInfo.FullPath for every entry returned, in
+	// addition to the base Name they always populate. This is computed
+	// client-side by joining the listed directory with each entry's Name,
+	// since the node's response doesn't carry it, so there's no extra
+	// round trip -- it defaults to off only to keep List's output
+	// unchanged for existing callers.
+	IncludeFullPath bool
+
+	// CheckDirectory tells AllocFS.Cat, AllocFS.Stream, and AllocFS.ReadAt
+	// to Stat path first and fail fast with ErrIsDirectory if it names a
+	// directory, rather than sending the request and relying on the node's
+	// own error. This costs an extra round trip, so it's opt-in; without
+	// it, those methods still recognize and wrap the node's "is a
+	// directory" error when one comes back.
+	CheckDirectory bool
+
+	// RequestID is sent as the X-Nomad-Request-ID header on client
+	// filesystem requests (AllocFS.Cat, AllocFS.Stream, and friends), so
+	// the same ID can be grepped for across client-side logs and the
+	// Nomad agent's own request logging. Callers can set it themselves to
+	// correlate a request with an ID from elsewhere; if left empty, it is
+	// filled in with a generated one before the request is sent, and left
+	// on this QueryOptions afterward so the caller can read back the ID
+	// that was actually used.
+	RequestID string
+
 	// ctx is an optional context pass through to the underlying HTTP
 	// request layer. Use Context() and WithContext() to manage this.
 	ctx context.Context
@@ -155,6 +250,92 @@ type Config struct {
 	//
 	// TLSConfig is ignored if HttpClient is set.
 	TLSConfig *TLSConfig
+
+	// UserAgent is sent via the User-Agent header on all outgoing requests,
+	// such as those issued against a client's filesystem endpoints. This
+	// lets operators tell a tool's traffic apart from Nomad's own clients
+	// for logging or rate-limiting purposes. Defaults to defaultUserAgent
+	// if left unset.
+	UserAgent string
+
+	// URLRewriter, if set, is called with the URL of every outgoing request
+	// before it is sent, and may mutate it in place. This is useful in
+	// environments where node-advertised addresses aren't directly
+	// routable, such as behind an ingress that maps node IDs to hostnames,
+	// letting operators rewrite the scheme, host, or path to a reachable
+	// endpoint.
+	URLRewriter func(*url.URL)
+
+	// MetricsObserver, if set, is notified of every AllocFS operation so
+	// callers can bridge call rates, latencies, and error rates to a
+	// metrics system (Prometheus, OpenTelemetry, ...) without this package
+	// depending on one itself.
+	MetricsObserver MetricsObserver
+
+	// Tracer, if set, is notified of the start and end of every AllocFS
+	// operation, with the node and path involved as attributes, so callers
+	// can bridge to a distributed tracing library without this package
+	// depending on one itself.
+	Tracer Tracer
+
+	// RedactSpanPaths, if set, replaces the path attribute in every span
+	// Tracer sees with a fixed placeholder instead of the real alloc path,
+	// for deployments where file paths are considered sensitive.
+	RedactSpanPaths bool
+
+	// MaxFSResponseBytes bounds how large a response body AllocFS.List and
+	// AllocFS.Stat will buffer in order to decode it, protecting the
+	// client from memory exhaustion if a misbehaving or malicious node
+	// returns a gigantic response. Defaults to 32MB if left zero. This
+	// complements the frame-size limits already enforced by the streaming
+	// methods.
+	MaxFSResponseBytes int64
+
+	// DialTimeout bounds how long connection establishment may take,
+	// independently of any overall request timeout. It is only used when
+	// HttpClient is unset, since a caller-supplied HttpClient is assumed to
+	// already be configured the way it wants. Defaults to 30s, the same as
+	// cleanhttp's default transport, if left zero.
+	DialTimeout time.Duration
+
+	// ProxyBaseURL, if set, routes every client filesystem request (Cat,
+	// Stream, List, and the rest of AllocFS) to {ProxyBaseURL}/v1/client/fs/...
+	// instead of dialing the allocation's node directly, with the node ID
+	// added as the "node" query parameter so the proxy can resolve it.
+	// This is for fronting many nodes with a single caching or
+	// log-archival proxy, centralizing access instead of every caller
+	// needing a direct path to each node. It has no effect on non-fs
+	// requests, which continue to go to Address as usual.
+	ProxyBaseURL string
+}
+
+// MetricsObserver receives a notification for every AllocFS operation.
+type MetricsObserver interface {
+	// ObserveRequest is called once per operation with the operation name,
+	// how long it took, and the error it returned, if any.
+	ObserveRequest(op string, dur time.Duration, err error)
+}
+
+// SpanToken is an opaque value returned by Tracer.StartSpan and handed back
+// unchanged to the matching Tracer.EndSpan call, so a Tracer implementation
+// can stash whatever it needs (a span object, a context, a timestamp) to
+// identify its own span without this package knowing its type.
+type SpanToken interface{}
+
+// Tracer receives a start/end notification around every AllocFS operation,
+// similar to MetricsObserver but carrying richer per-call attributes, so
+// callers can bridge to a distributed tracing library (OpenTelemetry,
+// Jaeger, ...) without this package depending on one itself.
+type Tracer interface {
+	// StartSpan is called before an operation begins, with the operation
+	// name (e.g. "List", "Cat") and its attributes, and returns a token
+	// identifying the span.
+	StartSpan(op string, attrs map[string]string) SpanToken
+
+	// EndSpan is called once the operation completes, with the token
+	// returned by the matching StartSpan call and the error the operation
+	// returned, if any.
+	EndSpan(token SpanToken, err error)
 }
 
 // ClientConfig copies the configuration with a new client address, region, and
@@ -165,14 +346,22 @@ func (c *Config) ClientConfig(region, address string, tlsEnabled bool) *Config {
 		scheme = "https"
 	}
 	config := &Config{
-		Address:    fmt.Sprintf("%s://%s", scheme, address),
-		Region:     region,
-		Namespace:  c.Namespace,
-		HttpClient: c.HttpClient,
-		SecretID:   c.SecretID,
-		HttpAuth:   c.HttpAuth,
-		WaitTime:   c.WaitTime,
-		TLSConfig:  c.TLSConfig.Copy(),
+		Address:            fmt.Sprintf("%s://%s", scheme, address),
+		Region:             region,
+		Namespace:          c.Namespace,
+		HttpClient:         c.HttpClient,
+		SecretID:           c.SecretID,
+		HttpAuth:           c.HttpAuth,
+		WaitTime:           c.WaitTime,
+		TLSConfig:          c.TLSConfig.Copy(),
+		UserAgent:          c.UserAgent,
+		URLRewriter:        c.URLRewriter,
+		MetricsObserver:    c.MetricsObserver,
+		Tracer:             c.Tracer,
+		RedactSpanPaths:    c.RedactSpanPaths,
+		MaxFSResponseBytes: c.MaxFSResponseBytes,
+		DialTimeout:        c.DialTimeout,
+		ProxyBaseURL:       c.ProxyBaseURL,
 	}
 
 	// Update the tls server name for connecting to a client
@@ -228,7 +417,7 @@ func (t *TLSConfig) Copy() *TLSConfig {
 	return nt
 }
 
-func defaultHttpClient() *http.Client {
+func defaultHttpClient(dialTimeout time.Duration) *http.Client {
 	httpClient := cleanhttp.DefaultClient()
 	transport := httpClient.Transport.(*http.Transport)
 	transport.TLSHandshakeTimeout = 10 * time.Second
@@ -236,6 +425,24 @@ func defaultHttpClient() *http.Client {
 		MinVersion: tls.VersionTLS12,
 	}
 
+	// Bound connection establishment independently of the overall request
+	// timeout, so a collector polling many nodes fails fast against dead
+	// ones instead of stalling on a dial while still allowing long reads
+	// (e.g. large file downloads) from nodes that do answer.
+	if dialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+
+	// Enable HTTP/2 over TLS. This benefits the client filesystem streaming
+	// endpoints (Stream, Logs), which hold long-lived connections that can
+	// share a single multiplexed HTTP/2 connection instead of each tying
+	// up its own TCP connection. If configuration fails the transport is
+	// left as-is and falls back to HTTP/1.1.
+	_ = http2.ConfigureTransport(transport)
+
 	return httpClient
 }
 
@@ -405,10 +612,76 @@ func ConfigureTLS(httpClient *http.Client, tlsConfig *TLSConfig) error {
 	return nil
 }
 
+// nodeSchemeState holds the cached node TLS-scheme overrides behind a
+// single pointer, rather than embedding the mutex directly in Client, so
+// that a shallow copy of Client (as WithContext makes) shares the same
+// cache and lock as the client it was derived from instead of silently
+// starting its own.
+type nodeSchemeState struct {
+	mu sync.Mutex
+
+	// cache holds, per node ID, an override of the scheme implied by the
+	// node's TLSEnabled flag. It is empty until flipNodeScheme records an
+	// override after a connection attempt fails with what looks like a TLS
+	// handshake mismatch, so the next GetNodeClient/GetNodeClientWithTimeout
+	// call (and, via queryClientNode, a retry of the current one) uses the
+	// opposite scheme instead of repeating the same failure.
+	cache map[string]bool
+}
+
 // Client provides a client to the Nomad API
 type Client struct {
 	httpClient *http.Client
 	config     Config
+
+	nodeScheme *nodeSchemeState
+
+	// baseCtx, if set via WithContext, is combined with the context of
+	// every request this client issues, so cancelling it is enough to end
+	// every in-flight operation without threading ctx through each call.
+	baseCtx context.Context
+}
+
+// WithContext returns a shallow copy of the client whose requests are all
+// additionally bound to ctx, on top of whatever context their own
+// QueryOptions or WriteOptions may already carry. This gives a caller a
+// single context to cancel (e.g. on process shutdown) that reaches every
+// in-flight operation issued through the returned client, rather than
+// needing to thread a context into each call individually. The client c
+// was called on is left unmodified.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	clone := *c
+	clone.baseCtx = ctx
+	return &clone
+}
+
+// flipNodeScheme overrides the cached TLS-scheme decision for nodeID to the
+// opposite of triedTLS, the scheme that was just attempted and failed with
+// what looks like a handshake mismatch. The next GetNodeClient/
+// GetNodeClientWithTimeout call for nodeID picks up the override instead of
+// repeating the same failing guess.
+func (c *Client) flipNodeScheme(nodeID string, triedTLS bool) {
+	c.nodeScheme.mu.Lock()
+	defer c.nodeScheme.mu.Unlock()
+	if c.nodeScheme.cache == nil {
+		c.nodeScheme.cache = make(map[string]bool)
+	}
+	c.nodeScheme.cache[nodeID] = !triedTLS
+}
+
+// isTLSHandshakeError reports whether err looks like it came from a TLS
+// handshake mismatch (e.g. speaking TLS to a plain HTTP port or vice
+// versa), as opposed to a connection-level failure such as a timeout or
+// refused connection.
+func isTLSHandshakeError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &recordErr) {
+		return true
+	}
+	return strings.Contains(err.Error(), "tls:")
 }
 
 // NewClient returns a new client
@@ -424,7 +697,7 @@ func NewClient(config *Config) (*Client, error) {
 
 	httpClient := config.HttpClient
 	if httpClient == nil {
-		httpClient = defaultHttpClient()
+		httpClient = defaultHttpClient(config.DialTimeout)
 		if err := ConfigureTLS(httpClient, config.TLSConfig); err != nil {
 			return nil, err
 		}
@@ -433,6 +706,7 @@ func NewClient(config *Config) (*Client, error) {
 	client := &Client{
 		config:     *config,
 		httpClient: httpClient,
+		nodeScheme: &nodeSchemeState{},
 	}
 	return client, nil
 }
@@ -478,11 +752,11 @@ func (c *Client) getNodeClientImpl(nodeID string, timeout time.Duration, q *Quer
 	if err != nil {
 		return nil, err
 	}
-	if node.Status == "down" {
-		return nil, NodeDownErr
+	if (q == nil || !q.AllowDownNode) && (node.Status == "down" || node.Status == "disconnected") {
+		return nil, fmt.Errorf("%w: node %q is %s, filesystem unavailable", NodeDownErr, nodeID, node.Status)
 	}
 	if node.HTTPAddr == "" {
-		return nil, fmt.Errorf("http addr of node %q (%s) is not advertised", node.Name, nodeID)
+		return nil, fmt.Errorf("%w: node %q (%s) has no advertised http addr", ErrNodeAddrNotAdvertised, node.Name, nodeID)
 	}
 
 	var region string
@@ -498,8 +772,19 @@ func (c *Client) getNodeClientImpl(nodeID string, timeout time.Duration, q *Quer
 		region = GlobalRegion
 	}
 
+	// Normally the scheme is derived straight from the node info. The only
+	// time the cache is consulted is after flipNodeScheme has recorded an
+	// override for this node, e.g. because the scheme the node info implied
+	// just failed a TLS handshake.
+	tlsEnabled := node.TLSEnabled
+	c.nodeScheme.mu.Lock()
+	if cached, ok := c.nodeScheme.cache[nodeID]; ok {
+		tlsEnabled = cached
+	}
+	c.nodeScheme.mu.Unlock()
+
 	// Get an API client for the node
-	conf := c.config.ClientConfig(region, node.HTTPAddr, node.TLSEnabled)
+	conf := c.config.ClientConfig(region, node.HTTPAddr, tlsEnabled)
 
 	// set timeout - preserve old behavior where errors are ignored and use untimed one
 	httpClient, err := cloneWithTimeout(c.httpClient, timeout)
@@ -509,7 +794,17 @@ func (c *Client) getNodeClientImpl(nodeID string, timeout time.Duration, q *Quer
 	}
 	conf.HttpClient = httpClient
 
-	return NewClient(conf)
+	nodeClient, err := NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	// A node client is a fresh Client, so it doesn't automatically inherit
+	// a base context set via WithContext on c; propagate it explicitly so
+	// cancelling c's base context still reaches requests issued directly
+	// against the node (e.g. queryClientNode's Cat/Stream/ReadAt calls).
+	nodeClient.baseCtx = c.baseCtx
+
+	return nodeClient, nil
 }
 
 // SetSecretID sets the ACL token secret for API requests.
@@ -527,6 +822,14 @@ type request struct {
 	body   io.Reader
 	obj    interface{}
 	ctx    context.Context
+	header http.Header
+
+	// clientCtx is the issuing Client's baseCtx, if any, captured at
+	// newRequest time. It's combined with ctx (the per-call QueryOptions/
+	// WriteOptions context) in toHTTP, rather than overwriting it, so a
+	// Client.WithContext base context and a per-call context both end the
+	// request.
+	clientCtx context.Context
 }
 
 // setQueryOptions is used to annotate the request with
@@ -544,6 +847,12 @@ func (r *request) setQueryOptions(q *QueryOptions) {
 	if q.AuthToken != "" {
 		r.token = q.AuthToken
 	}
+	if q.RequestID != "" {
+		if r.header == nil {
+			r.header = make(http.Header)
+		}
+		r.header.Set("X-Nomad-Request-ID", q.RequestID)
+	}
 	if q.AllowStale {
 		r.params.Set("stale", "")
 	}
@@ -585,15 +894,58 @@ func (r *request) setWriteOptions(q *WriteOptions) {
 	r.ctx = q.Context()
 }
 
-// toHTTP converts the request to an HTTP request
-func (r *request) toHTTP() (*http.Request, error) {
+// mergeContext returns a context that is done as soon as either a or b is
+// done, so a request can honor both a Client's base context (set via
+// WithContext) and its own per-call context without either one having to
+// be the other's parent. The standard library has no built-in way to
+// combine two independently-rooted contexts, so this spins a small
+// goroutine that exits as soon as either context ends. The caller owns the
+// returned cancel func and must call it once it's done with the context,
+// or the goroutine leaks until a itself is done.
+func mergeContext(a, b context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(b)
+	go func() {
+		select {
+		case <-a.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// cancelOnCloseBody wraps a response body so that closing it also releases
+// the cancel func from mergeContext, once the caller is done reading the
+// response (which, for streaming endpoints, may be long after the request
+// that created it returned).
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// toHTTP converts the request to an HTTP request. The returned cancel func
+// is non-nil only when the request's context was merged with the client's
+// base context (see mergeContext); the caller must call it once it's done
+// with the request to release the goroutine mergeContext spun up.
+func (r *request) toHTTP() (*http.Request, context.CancelFunc, error) {
 	// Encode the query parameters
 	r.url.RawQuery = r.params.Encode()
 
+	// Let the caller rewrite the target URL, e.g. to map a node address
+	// through an ingress, before the request is issued.
+	if r.config.URLRewriter != nil {
+		r.config.URLRewriter(r.url)
+	}
+
 	// Check if we should encode the body
 	if r.body == nil && r.obj != nil {
 		if b, err := encodeBody(r.obj); err != nil {
-			return nil, err
+			return nil, nil, err
 		} else {
 			r.body = b
 		}
@@ -605,11 +957,18 @@ func (r *request) toHTTP() (*http.Request, error) {
 		}
 		return context.Background()
 	}()
+	var cancel context.CancelFunc
+	if r.clientCtx != nil {
+		ctx, cancel = mergeContext(r.clientCtx, ctx)
+	}
 
 	// Create the HTTP request
 	req, err := http.NewRequestWithContext(ctx, r.method, r.url.RequestURI(), r.body)
 	if err != nil {
-		return nil, err
+		if cancel != nil {
+			cancel()
+		}
+		return nil, nil, err
 	}
 
 	// Optionally configure HTTP basic authentication
@@ -622,14 +981,24 @@ func (r *request) toHTTP() (*http.Request, error) {
 	}
 
 	req.Header.Add("Accept-Encoding", "gzip")
+	if r.config.UserAgent != "" {
+		req.Header.Set("User-Agent", r.config.UserAgent)
+	} else {
+		req.Header.Set("User-Agent", defaultUserAgent)
+	}
 	if r.token != "" {
 		req.Header.Set("X-Nomad-Token", r.token)
 	}
+	for k, vs := range r.header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
 
 	req.URL.Host = r.url.Host
 	req.URL.Scheme = r.url.Scheme
 	req.Host = r.url.Host
-	return req, nil
+	return req, cancel, nil
 }
 
 // newRequest is used to create a new request
@@ -640,8 +1009,9 @@ func (c *Client) newRequest(method, path string) (*request, error) {
 		return nil, err
 	}
 	r := &request{
-		config: &c.config,
-		method: method,
+		config:    &c.config,
+		method:    method,
+		clientCtx: c.baseCtx,
 		url: &url.URL{
 			Scheme:  base.Scheme,
 			User:    base.User,
@@ -696,7 +1066,7 @@ func (m *multiCloser) Read(p []byte) (int, error) {
 
 // doRequest runs a request with our client
 func (c *Client) doRequest(r *request) (time.Duration, *http.Response, error) {
-	req, err := r.toHTTP()
+	req, cancel, err := r.toHTTP()
 	if err != nil {
 		return 0, nil, err
 	}
@@ -711,6 +1081,9 @@ func (c *Client) doRequest(r *request) (time.Duration, *http.Response, error) {
 		case "gzip":
 			greader, err := gzip.NewReader(resp.Body)
 			if err != nil {
+				if cancel != nil {
+					cancel()
+				}
 				return 0, nil, err
 			}
 
@@ -726,6 +1099,17 @@ func (c *Client) doRequest(r *request) (time.Duration, *http.Response, error) {
 		resp.Body = reader
 	}
 
+	// cancel releases mergeContext's goroutine; tie it to the response
+	// body's Close so it's not called until the caller is done reading,
+	// which for streaming endpoints may be long after this call returns.
+	if cancel != nil {
+		if resp != nil {
+			resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+		} else {
+			cancel()
+		}
+	}
+
 	return diff, resp, err
 }
 
@@ -745,6 +1129,74 @@ func (c *Client) rawQuery(endpoint string, q *QueryOptions) (io.ReadCloser, erro
 	return resp.Body, nil
 }
 
+// retryableStatusMaxAttempts bounds how many times rawQueryRetryable will
+// retry a request whose response status is in QueryOptions.RetryableStatusCodes.
+const retryableStatusMaxAttempts = 3
+
+// retryableStatusDelay is the pause between retry attempts in rawQueryRetryable.
+const retryableStatusDelay = 250 * time.Millisecond
+
+// rawQueryRetryable behaves like rawQuery, but if q.RetryableStatusCodes is
+// set and the response status matches one of them, the request is retried
+// up to retryableStatusMaxAttempts times before the error is returned.
+func (c *Client) rawQueryRetryable(endpoint string, q *QueryOptions) (io.ReadCloser, error) {
+	var retryable map[int]bool
+	if q != nil && len(q.RetryableStatusCodes) > 0 {
+		retryable = make(map[int]bool, len(q.RetryableStatusCodes))
+		for _, code := range q.RetryableStatusCodes {
+			retryable[code] = true
+		}
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < retryableStatusMaxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryableStatusDelay)
+		}
+
+		body, statusCode, err := c.rawQueryStatus(endpoint, q)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+
+		if !retryable[statusCode] {
+			return nil, lastErr
+		}
+	}
+
+	return nil, lastErr
+}
+
+// rawQueryStatus behaves like rawQuery but also returns the HTTP status
+// code of the response, even on failure, so callers can decide whether to
+// retry.
+func (c *Client) rawQueryStatus(endpoint string, q *QueryOptions) (io.ReadCloser, int, error) {
+	r, err := c.newRequest("GET", endpoint)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.setQueryOptions(q)
+	_, resp, err := c.doRequest(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != 200 {
+		var buf bytes.Buffer
+		io.Copy(&buf, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusForbidden {
+			return nil, resp.StatusCode, fmt.Errorf("%w: %s", ErrPermissionDenied, buf.Bytes())
+		}
+		if resp.StatusCode == http.StatusNotFound && strings.Contains(buf.String(), "Unknown allocation") {
+			return nil, resp.StatusCode, fmt.Errorf("%w: %s", ErrAllocationGCd, buf.Bytes())
+		}
+		return nil, resp.StatusCode, fmt.Errorf("Unexpected response code: %d (%s)", resp.StatusCode, buf.Bytes())
+	}
+
+	return resp.Body, resp.StatusCode, nil
+}
+
 // websocket makes a websocket request to the specific endpoint
 func (c *Client) websocket(endpoint string, q *QueryOptions) (*websocket.Conn, *http.Response, error) {
 
@@ -771,10 +1223,16 @@ func (c *Client) websocket(endpoint string, q *QueryOptions) (*websocket.Conn, *
 	}
 	r.setQueryOptions(q)
 
-	rhttp, err := r.toHTTP()
+	rhttp, cancel, err := r.toHTTP()
 	if err != nil {
 		return nil, nil, err
 	}
+	// The websocket dialer below connects with rhttp's URL and headers, not
+	// rhttp itself, so its context is never observed; release it immediately
+	// rather than leaking it until the client's base context ends.
+	if cancel != nil {
+		defer cancel()
+	}
 
 	// convert scheme
 	wsScheme := ""
@@ -997,6 +1455,12 @@ func requireOK(d time.Duration, resp *http.Response, e error) (time.Duration, *h
 		var buf bytes.Buffer
 		io.Copy(&buf, resp.Body)
 		resp.Body.Close()
+		if resp.StatusCode == http.StatusForbidden {
+			return d, nil, fmt.Errorf("%w: %s", ErrPermissionDenied, buf.Bytes())
+		}
+		if resp.StatusCode == http.StatusNotFound && strings.Contains(buf.String(), "Unknown allocation") {
+			return d, nil, fmt.Errorf("%w: %s", ErrAllocationGCd, buf.Bytes())
+		}
 		return d, nil, fmt.Errorf("Unexpected response code: %d (%s)", resp.StatusCode, buf.Bytes())
 	}
 	return d, resp, nil
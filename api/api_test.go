@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -247,6 +249,32 @@ func TestWriteOptionsContext(t *testing.T) {
 	}
 }
 
+// TestClient_WithContext_ReleasesMergeContextGoroutine guards against a
+// goroutine leak in mergeContext: each request issued through a
+// WithContext-derived client used to spin up a goroutine that only exited
+// once the client's base context was done, even after the request itself
+// completed normally.
+func TestClient_WithContext_ReleasesMergeContextGoroutine(t *testing.T) {
+	t.Parallel()
+
+	c, s := makeClient(t, nil, nil)
+	defer s.Stop()
+
+	client := c.WithContext(context.Background())
+
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 50; i++ {
+		if _, _, err := client.Jobs().List(nil); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	require.Eventually(t, func() bool {
+		return runtime.NumGoroutine() <= before+5
+	}, 5*time.Second, 10*time.Millisecond, "goroutines leaked by requests through a WithContext client")
+}
+
 func TestSetWriteOptions(t *testing.T) {
 	t.Parallel()
 	c, s := makeClient(t, nil, nil)
@@ -283,7 +311,7 @@ func TestRequestToHTTP(t *testing.T) {
 		AuthToken: "foobar",
 	}
 	r.setQueryOptions(q)
-	req, err := r.toHTTP()
+	req, _, err := r.toHTTP()
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -353,7 +381,7 @@ func TestQueryString(t *testing.T) {
 	}
 	r.setWriteOptions(q)
 
-	req, err := r.toHTTP()
+	req, _, err := r.toHTTP()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -486,8 +514,87 @@ func TestClient_NodeClient(t *testing.T) {
 	}
 }
 
+func TestClient_NodeClient_DownNode(t *testing.T) {
+	downNode := func(string, *QueryOptions) (*Node, *QueryMeta, error) {
+		return &Node{ID: generateUUID(), Status: "down", HTTPAddr: "testdomain:4646"}, nil, nil
+	}
+	disconnectedNode := func(string, *QueryOptions) (*Node, *QueryMeta, error) {
+		return &Node{ID: generateUUID(), Status: "disconnected", HTTPAddr: "testdomain:4646"}, nil, nil
+	}
+	readyNode := func(string, *QueryOptions) (*Node, *QueryMeta, error) {
+		return &Node{ID: generateUUID(), Status: "ready", HTTPAddr: "testdomain:4646"}, nil, nil
+	}
+
+	client, err := NewClient(DefaultConfig())
+	require.NoError(t, err)
+
+	cases := []struct {
+		name    string
+		node    nodeLookup
+		opts    *QueryOptions
+		wantErr bool
+	}{
+		{name: "down node rejected", node: downNode, opts: nil, wantErr: true},
+		{name: "disconnected node rejected", node: disconnectedNode, opts: nil, wantErr: true},
+		{name: "down node allowed with AllowDownNode", node: downNode, opts: &QueryOptions{AllowDownNode: true}, wantErr: false},
+		{name: "ready node always allowed", node: readyNode, opts: nil, wantErr: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := client.getNodeClientImpl("testID", -1, c.opts, c.node)
+			if c.wantErr {
+				require.Error(t, err)
+				require.True(t, errors.Is(err, NodeDownErr))
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestClient_NodeSchemeCache(t *testing.T) {
+	nodeID := generateUUID()
+	lookupCalls := 0
+	node := func(string, *QueryOptions) (*Node, *QueryMeta, error) {
+		lookupCalls++
+		// The underlying node always reports TLS disabled; any https result
+		// below must come from the cache, not from re-deriving this value.
+		return &Node{ID: nodeID, Status: "ready", HTTPAddr: "testdomain:4646", TLSEnabled: false}, nil, nil
+	}
+
+	client, err := NewClient(DefaultConfig())
+	require.NoError(t, err)
+
+	nodeClient, err := client.getNodeClientImpl(nodeID, -1, nil, node)
+	require.NoError(t, err)
+	require.Equal(t, "http://testdomain:4646", nodeClient.config.Address)
+	require.Equal(t, 1, lookupCalls)
+
+	// A cache hit reuses the previously resolved scheme, even though the
+	// lookup keeps reporting TLS disabled, and doesn't need a fresh lookup
+	// for the decision itself.
+	client.flipNodeScheme(nodeID, false)
+	nodeClient, err = client.getNodeClientImpl(nodeID, -1, nil, node)
+	require.NoError(t, err)
+	require.Equal(t, "https://testdomain:4646", nodeClient.config.Address)
+
+	// Flipping again restores the plain-HTTP scheme.
+	client.flipNodeScheme(nodeID, true)
+	nodeClient, err = client.getNodeClientImpl(nodeID, -1, nil, node)
+	require.NoError(t, err)
+	require.Equal(t, "http://testdomain:4646", nodeClient.config.Address)
+}
+
+func TestIsTLSHandshakeError(t *testing.T) {
+	require.False(t, isTLSHandshakeError(nil))
+	require.False(t, isTLSHandshakeError(errors.New("connection refused")))
+	require.True(t, isTLSHandshakeError(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}))
+	require.True(t, isTLSHandshakeError(fmt.Errorf("remote error: tls: unexpected message")))
+}
+
 func TestCloneHttpClient(t *testing.T) {
-	client := defaultHttpClient()
+	client := defaultHttpClient(0)
 	originalTransport := client.Transport.(*http.Transport)
 	originalTransport.Proxy = func(*http.Request) (*url.URL, error) {
 		return nil, fmt.Errorf("stub function")
@@ -522,3 +629,32 @@ func TestCloneHttpClient(t *testing.T) {
 	})
 
 }
+
+func TestDefaultHttpClient_DialTimeout(t *testing.T) {
+	// A vanishingly small timeout guarantees the dial deadline is exceeded
+	// before the connection can be established, regardless of how fast the
+	// target actually responds, so this test is not sensitive to network
+	// conditions in the environment it runs in.
+	client := defaultHttpClient(1 * time.Nanosecond)
+	transport := client.Transport.(*http.Transport)
+	require.NotNil(t, transport.DialContext)
+
+	start := time.Now()
+	conn, err := transport.DialContext(context.Background(), "tcp", "127.0.0.1:1")
+	elapsed := time.Since(start)
+
+	require.Nil(t, conn)
+	require.Error(t, err)
+	require.True(t, elapsed < 1*time.Second, "dial took too long: %s", elapsed)
+}
+
+func TestNewClient_DialTimeout(t *testing.T) {
+	config := DefaultConfig()
+	config.DialTimeout = 42 * time.Millisecond
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	transport, ok := client.httpClient.Transport.(*http.Transport)
+	require.True(t, ok)
+	require.NotNil(t, transport.DialContext)
+}
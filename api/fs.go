@@ -1,13 +1,31 @@
 package api
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net"
+	"net/http"
+	"os"
+	gopath "path"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -26,8 +44,89 @@ type AllocFileInfo struct {
 	FileMode    string
 	ModTime     time.Time
 	ContentType string
+
+	// FullPath is the alloc-relative path to this entry, including the
+	// directory it was listed from. It's only populated by List and
+	// ListRecursive, and only when QueryOptions.IncludeFullPath is set;
+	// Name always stays the base name either way, so existing callers that
+	// only look at Name see no change in behavior.
+	FullPath string
+}
+
+// fileModePermBits maps each of the nine rwx characters in a FileMode
+// string, in order, to the os.FileMode bit it represents.
+var fileModePermBits = [9]struct {
+	ch  byte
+	bit os.FileMode
+}{
+	{'r', 0400}, {'w', 0200}, {'x', 0100},
+	{'r', 0040}, {'w', 0020}, {'x', 0010},
+	{'r', 0004}, {'w', 0002}, {'x', 0001},
+}
+
+// FileModeBits parses FileMode (as produced by Go's os.FileMode.String(),
+// e.g. "-rw-r--r--" or "drwxr-xr-x") into its numeric os.FileMode form, so
+// callers don't need to parse the permission string themselves.
+func (f *AllocFileInfo) FileModeBits() (os.FileMode, error) {
+	s := f.FileMode
+	if len(s) != 10 {
+		return 0, fmt.Errorf("unexpected file mode format: %q", s)
+	}
+
+	var mode os.FileMode
+	switch s[0] {
+	case 'd':
+		mode |= os.ModeDir
+	case 'L':
+		mode |= os.ModeSymlink
+	case '-':
+	default:
+		return 0, fmt.Errorf("unrecognized file type flag: %q", s[0])
+	}
+
+	perm := s[1:]
+	for i, b := range fileModePermBits {
+		switch perm[i] {
+		case b.ch:
+			mode |= b.bit
+		case '-':
+		default:
+			return 0, fmt.Errorf("unrecognized permission flag: %q", perm[i])
+		}
+	}
+
+	return mode, nil
+}
+
+// allocFileInfoAdapter wraps an AllocFileInfo to satisfy os.FileInfo (and
+// thus io/fs.FileInfo), so remote allocation filesystem entries can flow
+// through standard-library code that expects one. It's returned rather
+// than having AllocFileInfo implement the interface directly so that a
+// FileModeBits parse failure can be surfaced to the caller up front
+// instead of being swallowed by Mode().
+type allocFileInfoAdapter struct {
+	info *AllocFileInfo
+	mode os.FileMode
+}
+
+// ToOSFileInfo adapts f to os.FileInfo, parsing its FileMode string via
+// FileModeBits. This lets remote AllocFileInfo entries be passed to
+// standard-library or io/fs-based code that expects an os.FileInfo.
+func (f *AllocFileInfo) ToOSFileInfo() (os.FileInfo, error) {
+	mode, err := f.FileModeBits()
+	if err != nil {
+		return nil, err
+	}
+	return &allocFileInfoAdapter{info: f, mode: mode}, nil
 }
 
+func (a *allocFileInfoAdapter) Name() string       { return a.info.Name }
+func (a *allocFileInfoAdapter) Size() int64        { return a.info.Size }
+func (a *allocFileInfoAdapter) Mode() os.FileMode  { return a.mode }
+func (a *allocFileInfoAdapter) ModTime() time.Time { return a.info.ModTime }
+func (a *allocFileInfoAdapter) IsDir() bool        { return a.info.IsDir }
+func (a *allocFileInfoAdapter) Sys() interface{}   { return a.info }
+
 // StreamFrame is used to frame data of a file when streaming
 type StreamFrame struct {
 	Offset    int64  `json:",omitempty"`
@@ -44,6 +143,78 @@ func (s *StreamFrame) IsHeartbeat() bool {
 // AllocFS is used to introspect an allocation directory on a Nomad client
 type AllocFS struct {
 	client *Client
+
+	// cache, when set via SetCache, backs CatCached with a bounded
+	// in-memory content cache.
+	cache *FSCache
+
+	// streamSem, when set via SetStreamLimit, bounds the number of
+	// concurrent Stream calls this AllocFS will have open at once.
+	streamSem         chan struct{}
+	streamLimitPolicy StreamLimitPolicy
+
+	// clk, when set via setClock, overrides the clock used by time-dependent
+	// AllocFS behavior so it can be driven deterministically in tests.
+	clk clock
+
+	// nodeVersions caches each node's "nomad.version" attribute, keyed by
+	// NodeID, so RequireNodeVersion doesn't re-fetch node info on every
+	// call. Entries expire after nodeVersionCacheTTL so a long-lived Client
+	// eventually picks up a node's version after it's upgraded. Guarded by
+	// nodeVersionsMu.
+	nodeVersions   map[string]*nodeVersionCacheEntry
+	nodeVersionsMu sync.Mutex
+}
+
+// nodeVersionCacheTTL bounds how long an entry in AllocFS.nodeVersions is
+// trusted before nodeVersion re-fetches it, so a Client watching a cluster
+// through a rolling Nomad upgrade doesn't keep returning a node's
+// pre-upgrade version for the life of the process.
+const nodeVersionCacheTTL = 10 * time.Minute
+
+// nodeVersionCacheEntry is a single cached nodeVersion result.
+type nodeVersionCacheEntry struct {
+	version   string
+	expiresAt time.Time
+}
+
+// StreamLimitPolicy controls what Stream does once the limit configured
+// via SetStreamLimit is already reached.
+type StreamLimitPolicy int
+
+const (
+	// StreamLimitBlock waits for a slot to free up before opening the
+	// stream, respecting the caller's cancel channel.
+	StreamLimitBlock StreamLimitPolicy = iota
+
+	// StreamLimitError returns ErrStreamLimitReached immediately instead
+	// of waiting for a slot.
+	StreamLimitError
+)
+
+// ErrStreamLimitReached is returned by Stream, StreamWithKeepalive,
+// StreamLines, and StreamSSE, under StreamLimitError, when the limit
+// configured via SetStreamLimit is already reached.
+var ErrStreamLimitReached = fmt.Errorf("maximum concurrent streams reached")
+
+// SetStreamLimit bounds the number of concurrent open connections to a
+// node's /fs/stream endpoint, protecting both this process and the nodes
+// it talks to from exhausting file descriptors under large-scale log
+// aggregation. Once the limit is reached, policy determines whether
+// further calls block until a slot frees up or fail immediately with
+// ErrStreamLimitReached. Passing max <= 0 disables the limit. This governs
+// every helper that opens its own connection to /fs/stream -- Stream,
+// StreamWithKeepalive, StreamLines, and StreamSSE -- and everything built
+// on top of them (StreamReader, StreamWithHeartbeatTimeout, StreamGrep,
+// Lines, WaitForContent, and so on), since they all route through the
+// shared streamSetup helper.
+func (a *AllocFS) SetStreamLimit(max int, policy StreamLimitPolicy) {
+	if max <= 0 {
+		a.streamSem = nil
+		return
+	}
+	a.streamSem = make(chan struct{}, max)
+	a.streamLimitPolicy = policy
 }
 
 // AllocFS returns an handle to the AllocFS endpoints
@@ -51,132 +222,381 @@ func (c *Client) AllocFS() *AllocFS {
 	return &AllocFS{client: c}
 }
 
-// List is used to list the files at a given path of an allocation directory
-func (a *AllocFS) List(alloc *Allocation, path string, q *QueryOptions) ([]*AllocFileInfo, *QueryMeta, error) {
-	if q == nil {
-		q = &QueryOptions{}
+// observe reports op to the configured MetricsObserver, if any. It is
+// intended to be used with defer and a named error return:
+//
+//	defer func() { a.observe("List", time.Now(), err) }()
+func (a *AllocFS) observe(op string, start time.Time, err error) {
+	if obs := a.client.config.MetricsObserver; obs != nil {
+		obs.ObserveRequest(op, time.Since(start), err)
 	}
-	if q.Params == nil {
-		q.Params = make(map[string]string)
+}
+
+// startSpan starts a Tracer span for an AllocFS operation against alloc, if
+// a Tracer is configured, and returns the token to pass to endSpan along
+// with whether a span was actually started, since methods with no
+// configured Tracer shouldn't pay the cost of building attrs. path is
+// included as an attribute unless empty; it's redacted per
+// Config.RedactSpanPaths.
+//
+// It is intended to be used with defer and a named error return, the same
+// way observe is:
+//
+//	span, active := a.startSpan("List", alloc, path)
+//	defer func() { a.endSpan(span, active, err) }()
+func (a *AllocFS) startSpan(op string, alloc *Allocation, path string) (token SpanToken, active bool) {
+	tracer := a.client.config.Tracer
+	if tracer == nil {
+		return nil, false
+	}
+
+	attrs := map[string]string{"node_id": alloc.NodeID}
+	if path != "" {
+		if a.client.config.RedactSpanPaths {
+			attrs["path"] = "<redacted>"
+		} else {
+			attrs["path"] = path
+		}
+	}
+
+	return tracer.StartSpan(op, attrs), true
+}
+
+// endSpan ends the span started by startSpan, if one was actually started.
+func (a *AllocFS) endSpan(token SpanToken, active bool, err error) {
+	if !active {
+		return
+	}
+	a.client.config.Tracer.EndSpan(token, err)
+}
+
+// listAcceptContentTypes are the response Content-Types List knows how to
+// decode, most preferred first. Only JSON is supported today; this is the
+// extension point for a future, more efficient encoding (e.g. msgpack) that
+// newer nodes might offer: add it here and to the decode switch in List,
+// and older nodes that don't recognize the Accept header keep working
+// unchanged since they'll just fall back to their default of JSON.
+var listAcceptContentTypes = []string{"application/json"}
+
+// listUnsupportedContentTypes names response Content-Types that are known
+// to be an alternate List encoding this client doesn't (yet) know how to
+// decode. Anything else, including a blank or unexpected Content-Type, is
+// decoded as JSON, since that's every node's behavior today; this set only
+// exists so a node that starts speaking a real alternate encoding in the
+// future produces a clear error instead of a JSON decode failure.
+var listUnsupportedContentTypes = map[string]bool{
+	"application/msgpack":   true,
+	"application/x-msgpack": true,
+}
+
+// defaultMaxFSResponseBytes is the response body size List and Stat will
+// buffer in order to decode it when Config.MaxFSResponseBytes is left
+// zero.
+const defaultMaxFSResponseBytes = 32 * 1024 * 1024 // 32MB
+
+// ErrResponseTooLarge is returned by List and Stat instead of a decoded
+// result when a node's response body exceeds the configured (or default)
+// maximum, so a misbehaving or malicious node can't force the client to
+// buffer an unbounded amount of memory decoding it.
+type ErrResponseTooLarge struct {
+	// Limit is the byte limit that was exceeded.
+	Limit int64
+}
+
+func (e *ErrResponseTooLarge) Error() string {
+	return fmt.Sprintf("response too large: exceeds %d byte limit", e.Limit)
+}
+
+// decodeLimited reads resp.Body into out as JSON, refusing to buffer more
+// than a.client.config.MaxFSResponseBytes bytes (or defaultMaxFSResponseBytes
+// if that's left zero), returning *ErrResponseTooLarge instead of decoding
+// if the body turns out to be larger.
+func (a *AllocFS) decodeLimited(resp *http.Response, out interface{}) error {
+	return a.decodeLimitedReader(resp.Body, out)
+}
+
+// decodeLimitedReader is decodeLimited's underlying implementation, taking a
+// plain io.Reader so it can also be used on the body of a Cat stream, which
+// has no *http.Response to hand around.
+func (a *AllocFS) decodeLimitedReader(r io.Reader, out interface{}) error {
+	limit := a.client.config.MaxFSResponseBytes
+	if limit <= 0 {
+		limit = defaultMaxFSResponseBytes
 	}
-	q.Params["path"] = path
 
-	var resp []*AllocFileInfo
-	qm, err := a.client.query(fmt.Sprintf("/v1/client/fs/ls/%s", alloc.ID), &resp, q)
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
 	if err != nil {
-		return nil, nil, err
+		return err
+	}
+	if int64(len(data)) > limit {
+		return &ErrResponseTooLarge{Limit: limit}
 	}
 
-	return resp, qm, nil
+	return json.Unmarshal(data, out)
 }
 
-// Stat is used to stat a file at a given path of an allocation directory
-func (a *AllocFS) Stat(alloc *Allocation, path string, q *QueryOptions) (*AllocFileInfo, *QueryMeta, error) {
+// List is used to list the files at a given path of an allocation
+// directory. It sends an Accept header naming the response encodings it
+// knows how to decode, so a future node version could serve List in a more
+// efficient encoding for very large directories without breaking older
+// clients; if the node replies with a Content-Type this client doesn't
+// recognize, List returns a clear error rather than attempting to decode
+// nonsense as JSON.
+func (a *AllocFS) List(alloc *Allocation, path string, q *QueryOptions) (_ []*AllocFileInfo, _ *QueryMeta, err error) {
+	defer func(start time.Time) { a.observe("List", start, err) }(time.Now())
+	span, spanActive := a.startSpan("List", alloc, path)
+	defer func() { a.endSpan(span, spanActive, err) }()
+
 	if q == nil {
 		q = &QueryOptions{}
 	}
 	if q.Params == nil {
 		q.Params = make(map[string]string)
 	}
-
 	q.Params["path"] = path
 
-	var resp AllocFileInfo
-	qm, err := a.client.query(fmt.Sprintf("/v1/client/fs/stat/%s", alloc.ID), &resp, q)
+	r, err := a.client.newRequest("GET", fmt.Sprintf("/v1/client/fs/ls/%s", alloc.ID))
+	if err != nil {
+		return nil, nil, err
+	}
+	r.setQueryOptions(q)
+	r.header = http.Header{"Accept": {strings.Join(listAcceptContentTypes, ", ")}}
+
+	rtt, resp, err := requireOK(a.client.doRequest(r))
 	if err != nil {
 		return nil, nil, err
 	}
-	return &resp, qm, nil
+	defer resp.Body.Close()
+
+	qm := &QueryMeta{}
+	parseQueryMeta(resp, qm)
+	qm.RequestTime = rtt
+
+	contentType := resp.Header.Get("Content-Type")
+	if i := strings.Index(contentType, ";"); i != -1 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.TrimSpace(contentType)
+
+	if listUnsupportedContentTypes[contentType] {
+		return nil, nil, fmt.Errorf("unsupported List response Content-Type: %q", contentType)
+	}
+
+	var entries []*AllocFileInfo
+	if err := a.decodeLimited(resp, &entries); err != nil {
+		return nil, nil, err
+	}
+
+	if q.IncludeFullPath {
+		for _, entry := range entries {
+			entry.FullPath = gopath.Join(path, entry.Name)
+		}
+	}
+
+	return entries, qm, nil
 }
 
-// ReadAt is used to read bytes at a given offset until limit at the given path
-// in an allocation directory. If limit is <= 0, there is no limit.
-func (a *AllocFS) ReadAt(alloc *Allocation, path string, offset int64, limit int64, q *QueryOptions) (io.ReadCloser, error) {
-	reqPath := fmt.Sprintf("/v1/client/fs/readat/%s", alloc.ID)
+// ListSinceAllocStart is like List, but drops entries whose ModTime is at or
+// before alloc's own start time (alloc.CreateTime), so a path reused from a
+// previous allocation doesn't surface that allocation's stale files
+// alongside this run's own output. The comparison is ModTime as reported by
+// the node against CreateTime as reported by the server when alloc was
+// fetched, so it's only as precise as clock sync between the two: a file
+// written within a small window of the allocation starting may land on
+// either side of the cutoff.
+func (a *AllocFS) ListSinceAllocStart(alloc *Allocation, path string, q *QueryOptions) ([]*AllocFileInfo, *QueryMeta, error) {
+	entries, qm, err := a.List(alloc, path, q)
+	if err != nil {
+		return nil, qm, err
+	}
 
-	return queryClientNode(a.client, alloc, reqPath, q,
-		func(q *QueryOptions) {
-			q.Params["path"] = path
-			q.Params["offset"] = strconv.FormatInt(offset, 10)
-			q.Params["limit"] = strconv.FormatInt(limit, 10)
-		})
+	start := time.Unix(0, alloc.CreateTime)
+	var filtered []*AllocFileInfo
+	for _, entry := range entries {
+		if entry.ModTime.After(start) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered, qm, nil
 }
 
-// Cat is used to read contents of a file at the given path in an allocation
-// directory
-func (a *AllocFS) Cat(alloc *Allocation, path string, q *QueryOptions) (io.ReadCloser, error) {
-	reqPath := fmt.Sprintf("/v1/client/fs/cat/%s", alloc.ID)
-	return queryClientNode(a.client, alloc, reqPath, q,
-		func(q *QueryOptions) {
-			q.Params["path"] = path
-		})
+// ListRecursive lists path and, for every subdirectory found, recurses into
+// it too, returning every entry in the subtree as a single flat slice. Each
+// entry is exactly what List would have returned for it individually; the
+// caller is responsible for tracking parent/child relationships from
+// AllocFileInfo.Name alone.
+//
+// A subdirectory that fails to list (e.g. a permissions error on one
+// subtree) doesn't abort the whole call: ListRecursive keeps collecting
+// entries from every other subdirectory and returns them alongside the
+// failures, joined together with errors.Join, so a caller can inspect
+// (or errors.Is/As against) each individual failure without losing
+// everything gathered so far. The top-level List call is the exception --
+// if that fails there's nothing to return partial results for.
+func (a *AllocFS) ListRecursive(alloc *Allocation, path string, q *QueryOptions) ([]*AllocFileInfo, error) {
+	entries, _, err := a.List(alloc, path, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []*AllocFileInfo
+	var errs []error
+	for _, entry := range entries {
+		all = append(all, entry)
+		if !entry.IsDir {
+			continue
+		}
+
+		children, err := a.ListRecursive(alloc, gopath.Join(path, entry.Name), q)
+		all = append(all, children...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return all, errors.Join(errs...)
 }
 
-// Stream streams the content of a file blocking on EOF.
-// The parameters are:
-// * path: path to file to stream.
-// * offset: The offset to start streaming data at.
-// * origin: Either "start" or "end" and defines from where the offset is applied.
-// * cancel: A channel that when closed, streaming will end.
+// FileNode is a single node of the tree ListTree returns: the info for one
+// entry plus, if it's a directory, its children.
+type FileNode struct {
+	Info     *AllocFileInfo
+	Children []*FileNode
+}
+
+// ListTree returns the contents of path as a nested tree rooted at path,
+// built on top of ListRecursive, for callers (typically UIs) that want to
+// render an expandable file tree directly rather than reconstructing
+// parent/child relationships from a flat listing themselves.
 //
-// The return value is a channel that will emit StreamFrames as they are read.
-func (a *AllocFS) Stream(alloc *Allocation, path, origin string, offset int64,
-	cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+// maxDepth bounds how many levels below path are descended into: 0 returns
+// just path's own node with no children, 1 includes its immediate
+// children (but not grandchildren), and so on. A negative maxDepth means
+// unlimited depth. Each directory is only ever descended into once per
+// ListTree call, which doubles as loop protection against a node
+// misreporting a symlink as a directory that ultimately contains itself.
+//
+// Like ListRecursive, a subtree that fails to list doesn't discard the
+// rest of the tree: the returned *FileNode still contains every sibling
+// and ancestor that was reachable, and every failure encountered along the
+// way is joined together with errors.Join into the returned error.
+func (a *AllocFS) ListTree(alloc *Allocation, path string, maxDepth int, q *QueryOptions) (*FileNode, error) {
+	return a.listTree(alloc, path, maxDepth, make(map[string]bool), q)
+}
 
-	errCh := make(chan error, 1)
+func (a *AllocFS) listTree(alloc *Allocation, path string, depthRemaining int, visited map[string]bool, q *QueryOptions) (*FileNode, error) {
+	if visited[path] {
+		return nil, fmt.Errorf("listTree: loop detected at %q", path)
+	}
+	visited[path] = true
 
-	reqPath := fmt.Sprintf("/v1/client/fs/stream/%s", alloc.ID)
-	r, err := queryClientNode(a.client, alloc, reqPath, q,
-		func(q *QueryOptions) {
-			q.Params["path"] = path
-			q.Params["offset"] = strconv.FormatInt(offset, 10)
-			q.Params["origin"] = origin
-		})
+	info, _, err := a.Stat(alloc, path, q)
 	if err != nil {
-		errCh <- err
-		return nil, errCh
+		return nil, err
 	}
 
-	// Create the output channel
-	frames := make(chan *StreamFrame, 10)
+	node := &FileNode{Info: info}
+	if !info.IsDir || depthRemaining == 0 {
+		return node, nil
+	}
 
-	go func() {
-		// Close the body
-		defer r.Close()
+	entries, _, err := a.List(alloc, path, q)
+	if err != nil {
+		return node, err
+	}
 
-		// Create a decoder
-		dec := json.NewDecoder(r)
+	nextDepth := depthRemaining
+	if nextDepth > 0 {
+		nextDepth--
+	}
 
-		for {
-			// Check if we have been cancelled
-			select {
-			case <-cancel:
-				return
-			default:
-			}
+	var errs []error
+	for _, entry := range entries {
+		childPath := gopath.Join(path, entry.Name)
+		if !entry.IsDir {
+			node.Children = append(node.Children, &FileNode{Info: entry})
+			continue
+		}
 
-			// Decode the next frame
-			var frame StreamFrame
-			if err := dec.Decode(&frame); err != nil {
-				errCh <- err
-				close(frames)
-				return
-			}
+		child, err := a.listTree(alloc, childPath, nextDepth, visited, q)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if child != nil {
+			node.Children = append(node.Children, child)
+		}
+	}
 
-			// Discard heartbeat frames
-			if frame.IsHeartbeat() {
-				continue
-			}
+	return node, errors.Join(errs...)
+}
 
-			frames <- &frame
+// statManyGzipThreshold is the encoded request body size above which
+// StatMany gzip-compresses the path list before sending it. Small batches
+// aren't worth the CPU cost of compressing, so they're sent uncompressed.
+const statManyGzipThreshold = 8 * 1024
+
+// statManyRequest is the body StatMany sends to the stat-many endpoint.
+type statManyRequest struct {
+	Paths []string
+}
+
+// StatMany stats every path in paths within alloc's directory in a single
+// round trip, returning results keyed by the path as given. This avoids
+// one request per path when a caller (e.g. a UI rendering a whole
+// directory tree) needs to stat many files at once. Request bodies larger
+// than statManyGzipThreshold are gzip-compressed with Content-Encoding
+// set accordingly, to keep very large batches cheap on the wire.
+func (a *AllocFS) StatMany(alloc *Allocation, paths []string, q *QueryOptions) (_ map[string]*AllocFileInfo, err error) {
+	defer func(start time.Time) { a.observe("StatMany", start, err) }(time.Now())
+
+	body, err := json.Marshal(&statManyRequest{Paths: paths})
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := a.client.newRequest("PUT", fmt.Sprintf("/v1/client/fs/stat-many/%s", alloc.ID))
+	if err != nil {
+		return nil, err
+	}
+	r.setQueryOptions(q)
+
+	if len(body) > statManyGzipThreshold {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			return nil, err
 		}
-	}()
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		r.body = &buf
+		r.header = http.Header{"Content-Encoding": {"gzip"}}
+	} else {
+		r.body = bytes.NewReader(body)
+	}
 
-	return frames, errCh
+	_, resp, err := requireOK(a.client.doRequest(r))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out map[string]*AllocFileInfo
+	if err := a.decodeLimited(resp, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-func queryClientNode(c *Client, alloc *Allocation, reqPath string, q *QueryOptions, customizeQ func(*QueryOptions)) (io.ReadCloser, error) {
-	nodeClient, _ := c.GetNodeClientWithTimeout(alloc.NodeID, ClientConnTimeout, q)
+// Stat is used to stat a file at a given path of an allocation directory.
+// Its response body is bounded the same way List's is, via
+// Config.MaxFSResponseBytes, even though a single AllocFileInfo is
+// ordinarily tiny; this only matters against a node that is malfunctioning
+// or actively malicious.
+func (a *AllocFS) Stat(alloc *Allocation, path string, q *QueryOptions) (_ *AllocFileInfo, _ *QueryMeta, err error) {
+	defer func(start time.Time) { a.observe("Stat", start, err) }(time.Now())
+	span, spanActive := a.startSpan("Stat", alloc, path)
+	defer func() { a.endSpan(span, spanActive, err) }()
 
 	if q == nil {
 		q = &QueryOptions{}
@@ -184,200 +604,4542 @@ func queryClientNode(c *Client, alloc *Allocation, reqPath string, q *QueryOptio
 	if q.Params == nil {
 		q.Params = make(map[string]string)
 	}
-	if customizeQ != nil {
-		customizeQ(q)
+	q.Params["path"] = path
+
+	r, err := a.client.newRequest("GET", fmt.Sprintf("/v1/client/fs/stat/%s", alloc.ID))
+	if err != nil {
+		return nil, nil, err
 	}
+	r.setQueryOptions(q)
 
-	var r io.ReadCloser
-	var err error
+	rtt, resp, err := requireOK(a.client.doRequest(r))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
 
-	if nodeClient != nil {
-		r, err = nodeClient.rawQuery(reqPath, q)
-		if _, ok := err.(net.Error); err != nil && !ok {
-			// found a non networking error talking to client directly
-			return nil, err
-		}
+	qm := &QueryMeta{}
+	parseQueryMeta(resp, qm)
+	qm.RequestTime = rtt
 
+	var info AllocFileInfo
+	if err := a.decodeLimited(resp, &info); err != nil {
+		return nil, nil, err
 	}
 
-	// failed to query node, access through server directly
-	// or network error when talking to the client directly
-	if r == nil {
-		return c.rawQuery(reqPath, q)
+	if q.DetectContentType && !info.IsDir && info.Size > 0 {
+		contentType, err := a.detectContentType(alloc, path, q)
+		if err != nil {
+			return nil, nil, err
+		}
+		info.ContentType = contentType
 	}
 
-	return r, err
+	return &info, qm, nil
 }
 
-// Logs streams the content of a tasks logs blocking on EOF.
-// The parameters are:
-// * allocation: the allocation to stream from.
-// * follow: Whether the logs should be followed.
-// * task: the tasks name to stream logs for.
-// * logType: Either "stdout" or "stderr"
-// * origin: Either "start" or "end" and defines from where the offset is applied.
-// * offset: The offset to start streaming data at.
-// * cancel: A channel that when closed, streaming will end.
-//
-// The return value is a channel that will emit StreamFrames as they are read.
-// The chan will be closed when follow=false and the end of the file is
-// reached.
-//
-// Unexpected (non-EOF) errors will be sent on the error chan.
-func (a *AllocFS) Logs(alloc *Allocation, follow bool, task, logType, origin string,
-	offset int64, cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
-
-	errCh := make(chan error, 1)
+// detectContentType reads the first 512 bytes of path and sniffs its
+// content type the same way net/http's DetectContentType does for
+// response bodies. 512 bytes is the most DetectContentType ever
+// inspects, so there's no benefit to reading more.
+func (a *AllocFS) detectContentType(alloc *Allocation, path string, q *QueryOptions) (string, error) {
+	r, err := a.ReadAt(alloc, path, 0, 512, q)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
 
-	reqPath := fmt.Sprintf("/v1/client/fs/logs/%s", alloc.ID)
-	r, err := queryClientNode(a.client, alloc, reqPath, q,
-		func(q *QueryOptions) {
-			q.Params["follow"] = strconv.FormatBool(follow)
-			q.Params["task"] = task
-			q.Params["type"] = logType
-			q.Params["origin"] = origin
-			q.Params["offset"] = strconv.FormatInt(offset, 10)
-		})
+	buf, err := io.ReadAll(r)
 	if err != nil {
-		errCh <- err
-		return nil, errCh
+		return "", err
 	}
+	return http.DetectContentType(buf), nil
+}
 
-	// Create the output channel
-	frames := make(chan *StreamFrame, 10)
+// ErrFileNotFound is returned by IsDir when path does not exist.
+var ErrFileNotFound = fmt.Errorf("file not found")
 
-	go func() {
-		// Close the body
-		defer r.Close()
+// IsDir reports whether path is a directory, via Stat. It returns
+// ErrFileNotFound, wrapped so errors.Is still matches, if path doesn't
+// exist, saving callers who only care about the directory-or-not
+// distinction from inspecting a *AllocFileInfo themselves.
+func (a *AllocFS) IsDir(alloc *Allocation, path string, q *QueryOptions) (bool, error) {
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		if isNotFoundError(err) {
+			return false, fmt.Errorf("%s: %w", path, ErrFileNotFound)
+		}
+		return false, err
+	}
 
-		// Create a decoder
-		dec := json.NewDecoder(r)
+	return info.IsDir, nil
+}
 
-		for {
-			// Check if we have been cancelled
+// SecretFileInfo describes a single file found under a task's secrets
+// directory. Content is nil unless it was explicitly requested via
+// ReadSecret(..., redact=false); callers must opt in to reading secret
+// bytes rather than getting them by default.
+type SecretFileInfo struct {
+	*AllocFileInfo
+	Content []byte
+}
+
+// ListSecrets lists the files in task's secrets directory
+// (alloc/<id>/<task>/secrets). Like List, it never returns file content,
+// only names, sizes, and the other AllocFileInfo metadata, so it's safe to
+// call without any redaction option of its own.
+func (a *AllocFS) ListSecrets(alloc *Allocation, task string, q *QueryOptions) ([]*AllocFileInfo, *QueryMeta, error) {
+	return a.List(alloc, gopath.Join(task, "secrets"), q)
+}
+
+// ReadSecret reads a single file out of task's secrets directory. When
+// redact is true, the file's content is never requested from the node and
+// SecretFileInfo.Content is left nil, so general-purpose debugging tools
+// can default to redact=true and only see names and sizes. Passing
+// redact=false is an explicit, authorized opt-in to read the actual
+// secret bytes.
+func (a *AllocFS) ReadSecret(alloc *Allocation, task, name string, redact bool, q *QueryOptions) (*SecretFileInfo, error) {
+	path := gopath.Join(task, "secrets", name)
+
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return nil, err
+	}
+	if redact {
+		return &SecretFileInfo{AllocFileInfo: info}, nil
+	}
+
+	r, err := a.Cat(alloc, path, q)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretFileInfo{AllocFileInfo: info, Content: content}, nil
+}
+
+// TaskFS is a handle scoped to a single task within an allocation. Its
+// methods take paths relative to the task's own working directory (e.g.
+// "local/config.conf") rather than the allocation-relative paths List,
+// Stat, Cat, and Stream otherwise require, so callers don't have to
+// hardcode the "<task>/" prefix Nomad uses internally, which has changed
+// across versions before.
+type TaskFS struct {
+	allocFS *AllocFS
+	alloc   *Allocation
+	task    string
+}
+
+// TaskFS returns a handle for reading files relative to task's working
+// directory within alloc.
+func (a *AllocFS) TaskFS(alloc *Allocation, task string) *TaskFS {
+	return &TaskFS{allocFS: a, alloc: alloc, task: task}
+}
+
+// resolve translates a task-relative path into the alloc-relative path the
+// underlying AllocFS methods expect.
+func (t *TaskFS) resolve(path string) string {
+	return gopath.Join(t.task, path)
+}
+
+// List is like AllocFS.List, but path is relative to the task's working
+// directory.
+func (t *TaskFS) List(path string, q *QueryOptions) ([]*AllocFileInfo, *QueryMeta, error) {
+	return t.allocFS.List(t.alloc, t.resolve(path), q)
+}
+
+// Stat is like AllocFS.Stat, but path is relative to the task's working
+// directory.
+func (t *TaskFS) Stat(path string, q *QueryOptions) (*AllocFileInfo, *QueryMeta, error) {
+	return t.allocFS.Stat(t.alloc, t.resolve(path), q)
+}
+
+// Cat is like AllocFS.Cat, but path is relative to the task's working
+// directory.
+func (t *TaskFS) Cat(path string, q *QueryOptions) (io.ReadCloser, error) {
+	return t.allocFS.Cat(t.alloc, t.resolve(path), q)
+}
+
+// Stream is like AllocFS.Stream, but path is relative to the task's
+// working directory.
+func (t *TaskFS) Stream(path, origin string, offset int64, cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+	return t.allocFS.Stream(t.alloc, t.resolve(path), origin, offset, cancel, q)
+}
+
+// ErrFileChanged is returned by CatConsistent when the file at the
+// requested path changed, per its reported size or modification time,
+// between the initial Stat and the Cat read that followed it. This
+// catches the common log-rotation race where a caller measures a file
+// with Stat and then reads a different file (or a truncated/rewritten
+// one) with Cat. It carries no details of its own; callers that need
+// them should inspect the AllocFileInfo values returned alongside it.
+var ErrFileChanged = fmt.Errorf("file changed between stat and read")
+
+// CatConsistent reads the file at path the same way Cat does, but
+// guards against the file changing between the measurement and the
+// read: it Stats path, Cats it, then Stats it again and compares the
+// two AllocFileInfo values. If the size or modification time differs,
+// the reader is closed and ErrFileChanged is returned instead, along
+// with the before/after AllocFileInfo so the caller can decide whether
+// to retry. This doesn't require anything beyond Stat and Cat from the
+// node, so it works against any node regardless of whether it reports a
+// more precise file identity such as an inode or generation number.
+func (a *AllocFS) CatConsistent(alloc *Allocation, path string, q *QueryOptions) (_ io.ReadCloser, before, after *AllocFileInfo, err error) {
+	before, _, err = a.Stat(alloc, path, q)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	r, err := a.Cat(alloc, path, q)
+	if err != nil {
+		return nil, before, nil, err
+	}
+
+	after, _, err = a.Stat(alloc, path, q)
+	if err != nil {
+		r.Close()
+		return nil, before, nil, err
+	}
+
+	if after.Size != before.Size || !after.ModTime.Equal(before.ModTime) {
+		r.Close()
+		return nil, before, after, ErrFileChanged
+	}
+
+	return r, before, after, nil
+}
+
+// ReadAt is used to read bytes at a given offset until limit at the given path
+// in an allocation directory. offset and limit must both be non-negative;
+// limit == 0 means read to the end of the file. A negative offset or limit
+// is rejected client-side rather than sent to the node, which would
+// otherwise produce undefined behavior.
+//
+// If path names a directory, ReadAt returns ErrIsDirectory: immediately,
+// via a client-side Stat, if QueryOptions.CheckDirectory is set; otherwise
+// by recognizing the node's own error once the request fails.
+func (a *AllocFS) ReadAt(alloc *Allocation, path string, offset int64, limit int64, q *QueryOptions) (_ io.ReadCloser, err error) {
+	defer func(start time.Time) { a.observe("ReadAt", start, err) }(time.Now())
+	span, spanActive := a.startSpan("ReadAt", alloc, path)
+	defer func() { a.endSpan(span, spanActive, err) }()
+
+	if offset < 0 {
+		return nil, fmt.Errorf("offset must be >= 0, got %d", offset)
+	}
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must be >= 0, got %d", limit)
+	}
+
+	if q != nil && q.CheckDirectory {
+		if err := a.checkNotDirectory(alloc, path, q); err != nil {
+			return nil, err
+		}
+	}
+
+	reqPath := fmt.Sprintf("/v1/client/fs/readat/%s", alloc.ID)
+
+	r, err := queryClientNode(a.client, alloc, reqPath, q,
+		func(q *QueryOptions) {
+			q.Params["path"] = path
+			q.Params["offset"] = strconv.FormatInt(offset, 10)
+			q.Params["limit"] = strconv.FormatInt(limit, 10)
+		})
+	if err != nil && isDirectoryError(err) {
+		err = fmt.Errorf("%s: %w", path, ErrIsDirectory)
+	}
+	return r, err
+}
+
+// ReadAtBuf performs a ranged read of len(p) bytes from path at offset
+// directly into p and returns the number of bytes read, following
+// io.ReaderAt's contract: a short read, including one caused by hitting
+// the end of the file, is reported via a non-nil error alongside the
+// bytes actually read. Unlike ReadAt, it doesn't allocate a reader for
+// the caller to manage, which suits hot loops that read the same file
+// repeatedly. It is cancelable via ctx rather than a cancel channel.
+func (a *AllocFS) ReadAtBuf(ctx context.Context, alloc *Allocation, path string, p []byte, offset int64, q *QueryOptions) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	r, err := a.ReadAt(alloc, path, offset, int64(len(p)), q)
+	if err != nil {
+		return 0, err
+	}
+	var closeOnce sync.Once
+	closeReader := func() { closeOnce.Do(func() { r.Close() }) }
+	defer closeReader()
+
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := io.ReadFull(r, p)
+		done <- result{n, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err == io.ErrUnexpectedEOF {
+			res.err = io.EOF
+		}
+		return res.n, res.err
+	case <-ctx.Done():
+		closeReader()
+		<-done
+		return 0, ctx.Err()
+	}
+}
+
+// SeekableReader is an io.ReadSeekCloser over a remote alloc file, backed by
+// ReadAt and Stat. Unlike Cat's streamed reader, it lets a caller Seek
+// around the file -- forward, backward, or relative to the end -- as if it
+// were local, at the cost of an extra request per Seek call to fetch the
+// data at the new position plus, for SeekEnd, a Stat to learn the file's
+// current size.
+type SeekableReader struct {
+	fs     *AllocFS
+	alloc  *Allocation
+	path   string
+	q      *QueryOptions
+	offset int64
+}
+
+// SeekableReader returns an io.ReadSeekCloser over path, for callers that
+// want to seek around a remote file (e.g. to a computed position, or to
+// inspect binary content) instead of reading it start to end.
+func (a *AllocFS) SeekableReader(alloc *Allocation, path string, q *QueryOptions) (io.ReadSeekCloser, error) {
+	return &SeekableReader{fs: a, alloc: alloc, path: path, q: q}, nil
+}
+
+func (s *SeekableReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	r, err := s.fs.ReadAt(s.alloc, s.path, s.offset, int64(len(p)), s.q)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	n, err := io.ReadFull(r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	s.offset += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker. SeekEnd requires a Stat round trip to learn
+// the file's current size. Seeking past EOF is allowed, matching
+// os.File's behavior; the next Read simply returns io.EOF immediately
+// rather than an out-of-range error.
+func (s *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	var base int64
+
+	switch whence {
+	case io.SeekStart:
+		base = 0
+	case io.SeekCurrent:
+		base = s.offset
+	case io.SeekEnd:
+		info, _, err := s.fs.Stat(s.alloc, s.path, s.q)
+		if err != nil {
+			return 0, err
+		}
+		base = info.Size
+	default:
+		return 0, fmt.Errorf("SeekableReader.Seek: invalid whence %d", whence)
+	}
+
+	newOffset := base + offset
+	if newOffset < 0 {
+		return 0, fmt.Errorf("SeekableReader.Seek: negative position")
+	}
+
+	s.offset = newOffset
+	return s.offset, nil
+}
+
+// Close is a no-op: SeekableReader opens a fresh request for every Read,
+// holding no connection open between calls that would need closing.
+func (s *SeekableReader) Close() error {
+	return nil
+}
+
+// ErrIsDirectory is returned by Cat, Stream, and ReadAt when path names a
+// directory rather than a file, instead of whatever unclear error or
+// behavior the node would otherwise produce. It's surfaced either from a
+// client-side Stat, when QueryOptions.CheckDirectory opts into the extra
+// round trip, or by recognizing the node's own "is a directory" error text
+// otherwise, so callers get the same clear signal either way.
+var ErrIsDirectory = fmt.Errorf("path is a directory, use List")
+
+// isDirectoryError reports whether err is the "is a directory" error a node
+// produces when asked to stream or read a directory as if it were a file.
+func isDirectoryError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "is a directory")
+}
+
+// checkNotDirectory performs a client-side Stat of path and returns
+// ErrIsDirectory, wrapped so errors.Is still matches, if it names a
+// directory. It's only called when QueryOptions.CheckDirectory opts into
+// the extra round trip.
+func (a *AllocFS) checkNotDirectory(alloc *Allocation, path string, q *QueryOptions) error {
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return err
+	}
+	if info.IsDir {
+		return fmt.Errorf("%s: %w", path, ErrIsDirectory)
+	}
+	return nil
+}
+
+// Cat is used to read contents of a file at the given path in an allocation
+// directory. The returned reader is an *FSReader, so callers that want to
+// copy it directly to a destination can use its WriteTo method.
+//
+// If path names a directory, Cat returns ErrIsDirectory: immediately, via a
+// client-side Stat, if QueryOptions.CheckDirectory is set; otherwise by
+// recognizing the node's own error once the request fails.
+func (a *AllocFS) Cat(alloc *Allocation, path string, q *QueryOptions) (_ io.ReadCloser, err error) {
+	defer func(start time.Time) { a.observe("Cat", start, err) }(time.Now())
+	span, spanActive := a.startSpan("Cat", alloc, path)
+	defer func() { a.endSpan(span, spanActive, err) }()
+
+	if q != nil && q.CheckDirectory {
+		if err := a.checkNotDirectory(alloc, path, q); err != nil {
+			return nil, err
+		}
+	}
+
+	reqPath := fmt.Sprintf("/v1/client/fs/cat/%s", alloc.ID)
+	r, err := queryClientNode(a.client, alloc, reqPath, q,
+		func(q *QueryOptions) {
+			q.Params["path"] = path
+		})
+	if err != nil {
+		if isDirectoryError(err) {
+			err = fmt.Errorf("%s: %w", path, ErrIsDirectory)
+		}
+		return nil, err
+	}
+	return &FSReader{ReadCloser: r}, nil
+}
+
+// FSReader wraps an io.ReadCloser returned by an AllocFS method and adds an
+// io.WriterTo implementation, so callers can write the contents of a file
+// or log directly to a destination such as os.Stdout via WriteTo, rather
+// than an explicit io.Copy call. Cat and CombinedLogs return a value of
+// this type.
+type FSReader struct {
+	io.ReadCloser
+}
+
+// WriteTo copies the remaining contents of the reader into w.
+func (r *FSReader) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, r.ReadCloser)
+}
+
+// ReadJSON is a convenience wrapper around Cat for files in the alloc
+// directory that hold a single JSON document, such as a periodic
+// resource-usage snapshot a task writes for its own sidecar to pick up. It
+// decodes into v, refusing to buffer more than Config.MaxFSResponseBytes (or
+// defaultMaxFSResponseBytes if that's left zero) and returning
+// *ErrResponseTooLarge if the file exceeds it, so callers don't each
+// reimplement the cat-then-decode boilerplate with their own size limit.
+func (a *AllocFS) ReadJSON(alloc *Allocation, path string, v interface{}, q *QueryOptions) (err error) {
+	defer func(start time.Time) { a.observe("ReadJSON", start, err) }(time.Now())
+	span, spanActive := a.startSpan("ReadJSON", alloc, path)
+	defer func() { a.endSpan(span, spanActive, err) }()
+
+	r, err := a.Cat(alloc, path, q)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := a.decodeLimitedReader(r, v); err != nil {
+		if _, ok := err.(*ErrResponseTooLarge); ok {
+			return err
+		}
+		return fmt.Errorf("%s: invalid JSON: %w", path, err)
+	}
+	return nil
+}
+
+// RetryableReader wraps Cat's body so a transient read error partway
+// through a large download doesn't force the caller to restart from
+// scratch. On a read error it re-Stats the file and re-issues a ranged
+// ReadAt picking up from the offset already delivered, resuming the read
+// transparently instead of surfacing the error to the caller. It gives up
+// and returns the underlying error once downloadRetries consecutive
+// resume attempts have failed.
+type RetryableReader struct {
+	fs     *AllocFS
+	alloc  *Allocation
+	path   string
+	q      *QueryOptions
+	offset int64
+	r      io.ReadCloser
+}
+
+// CatRetryable is like Cat, but returns a RetryableReader instead of a
+// plain io.ReadCloser, so a connection blip partway through doesn't force
+// the caller to start over from offset 0.
+func (a *AllocFS) CatRetryable(alloc *Allocation, path string, q *QueryOptions) (*RetryableReader, error) {
+	r, err := a.Cat(alloc, path, q)
+	if err != nil {
+		return nil, err
+	}
+	return &RetryableReader{fs: a, alloc: alloc, path: path, q: q, r: r}, nil
+}
+
+func (rr *RetryableReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.offset += int64(n)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+
+	for attempt := 0; attempt < downloadRetries; attempt++ {
+		rr.r.Close()
+
+		next, resumeErr := rr.resume()
+		if resumeErr != nil {
+			err = resumeErr
+			continue
+		}
+		rr.r = next
+		return n, nil
+	}
+
+	return n, fmt.Errorf("failed to resume read of %s at offset %d: %w", rr.path, rr.offset, err)
+}
+
+// resume re-Stats path and, if there's anything left to read, opens a
+// ranged ReadAt starting at the offset already delivered to the caller.
+func (rr *RetryableReader) resume() (io.ReadCloser, error) {
+	info, _, err := rr.fs.Stat(rr.alloc, rr.path, rr.q)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := info.Size - rr.offset
+	if remaining <= 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	return rr.fs.ReadAt(rr.alloc, rr.path, rr.offset, remaining, rr.q)
+}
+
+// Close closes the underlying reader currently in use.
+func (rr *RetryableReader) Close() error {
+	return rr.r.Close()
+}
+
+// ErrAllocStopped is returned by a reader from CatWithAllocStatusCheck once
+// the allocation being read from transitions out of the running state
+// mid-transfer.
+var ErrAllocStopped = fmt.Errorf("allocation stopped during transfer")
+
+// allocStatusWatcher polls alloc's status every checkInterval and closes
+// the returned stopped channel once it is no longer pending or running, so
+// a long transfer can abort instead of continuing to read from a
+// connection the node has no reason left to serve. A checkInterval <= 0
+// disables the watcher: stopped is nil and cancelWatch is a no-op, for
+// callers that want to skip the extra polling round trips.
+func (a *AllocFS) allocStatusWatcher(alloc *Allocation, checkInterval time.Duration, q *QueryOptions) (stopped <-chan struct{}, cancelWatch func()) {
+	if checkInterval <= 0 {
+		return nil, func() {}
+	}
+
+	done := make(chan struct{})
+	stop := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				cur, _, err := a.client.Allocations().Info(alloc.ID, q)
+				if err != nil {
+					continue
+				}
+				if cur.ClientStatus != AllocClientStatusPending && cur.ClientStatus != AllocClientStatusRunning {
+					close(stop)
+					return
+				}
+			}
+		}
+	}()
+
+	var closeOnce sync.Once
+	return stop, func() { closeOnce.Do(func() { close(done) }) }
+}
+
+// statusCheckedReader wraps a reader with an allocStatusWatcher, failing
+// reads with ErrAllocStopped once the watcher reports the allocation
+// stopped.
+type statusCheckedReader struct {
+	r           io.ReadCloser
+	stopped     <-chan struct{}
+	cancelWatch func()
+}
+
+func (s *statusCheckedReader) Read(p []byte) (int, error) {
+	select {
+	case <-s.stopped:
+		return 0, ErrAllocStopped
+	default:
+	}
+	return s.r.Read(p)
+}
+
+func (s *statusCheckedReader) Close() error {
+	s.cancelWatch()
+	return s.r.Close()
+}
+
+// CatWithAllocStatusCheck is like Cat, but also polls alloc's status every
+// checkInterval and fails subsequent reads with ErrAllocStopped once the
+// allocation is no longer pending or running, so a caller reading a large
+// file isn't left reading indefinitely from a connection the node has
+// stopped serving. A checkInterval <= 0 skips the status check entirely and
+// behaves exactly like Cat, for callers that want to skip the extra round
+// trips.
+func (a *AllocFS) CatWithAllocStatusCheck(alloc *Allocation, path string, checkInterval time.Duration, q *QueryOptions) (io.ReadCloser, error) {
+	r, err := a.Cat(alloc, path, q)
+	if err != nil {
+		return nil, err
+	}
+	if checkInterval <= 0 {
+		return r, nil
+	}
+
+	stopped, cancelWatch := a.allocStatusWatcher(alloc, checkInterval, q)
+	return &statusCheckedReader{r: r, stopped: stopped, cancelWatch: cancelWatch}, nil
+}
+
+// WaitForMinSize polls Stat at the given interval until the file at path
+// reaches at least minSize bytes, returning its final AllocFileInfo. This is
+// useful for waiting on a task to produce enough output before reading it,
+// rather than racing a read against a file still being written. It returns
+// ctx.Err() if ctx is done before the file reaches minSize.
+func (a *AllocFS) WaitForMinSize(ctx context.Context, alloc *Allocation, path string, minSize int64,
+	interval time.Duration, q *QueryOptions) (*AllocFileInfo, error) {
+
+	if interval <= 0 {
+		interval = 250 * time.Millisecond
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		info, _, err := a.Stat(alloc, path, q)
+		if err == nil && info.Size >= minSize {
+			return info, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// GrowthRate takes two Stats of path, window apart, and returns the average
+// rate at which it grew over that interval in bytes per second. This is a
+// cheap way to tell whether a log producer is still actively writing or has
+// gone quiet, without following the file itself. A shrinking or truncated
+// file (the second Stat reporting a smaller size than the first) yields a
+// negative rate.
+func (a *AllocFS) GrowthRate(alloc *Allocation, path string, window time.Duration, q *QueryOptions) (bytesPerSec float64, err error) {
+	before, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return 0, err
+	}
+
+	timer := a.clock().NewTimer(window)
+	defer timer.Stop()
+	<-timer.C()
+
+	after, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(after.Size-before.Size) / window.Seconds(), nil
+}
+
+// IsStalled reports whether path has grown by less than minBytesPerSec over
+// window, the common "is this log producer stuck" check built on top of
+// GrowthRate.
+func (a *AllocFS) IsStalled(alloc *Allocation, path string, window time.Duration, minBytesPerSec float64, q *QueryOptions) (bool, error) {
+	rate, err := a.GrowthRate(alloc, path, window, q)
+	if err != nil {
+		return false, err
+	}
+
+	return rate < minBytesPerSec, nil
+}
+
+// WaitForContent follows the file at path and returns true as soon as a
+// line satisfying pred arrives, or false if maxWait elapses or cancel is
+// closed first without one appearing. This is the common "wait until the
+// log contains READY" shape integration tests and orchestration need,
+// without the caller wiring up its own streaming and matching on top of
+// StreamLines.
+func (a *AllocFS) WaitForContent(alloc *Allocation, path string, pred func(line string) bool,
+	maxWait time.Duration, cancel <-chan struct{}, q *QueryOptions) (bool, error) {
+
+	innerCancel := make(chan struct{})
+	defer close(innerCancel)
+
+	lines, errCh := a.StreamLines(alloc, path, OriginStart, 0, StreamConfig{}, nil, innerCancel, q)
+
+	timeout := time.NewTimer(maxWait)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return false, nil
+			}
+			if pred(line) {
+				return true, nil
+			}
+		case err := <-errCh:
+			return false, err
+		case <-timeout.C:
+			return false, nil
+		case <-cancel:
+			return false, nil
+		}
+	}
+}
+
+// Watch polls path at pollInterval and emits the latest AllocFileInfo on
+// the returned channel whenever a change (in Size or ModTime) settles: once
+// a change is observed, Watch waits debounce for further changes before
+// emitting, restarting the debounce timer on every additional change seen
+// in the meantime, so a burst of rapid writes produces one emission instead
+// of one per poll. If path is deleted, Watch emits one final terminal
+// AllocFileInfo with IsDir and Size both zero and then closes the channel.
+// The channel is also closed, with no further emissions, once cancel is
+// closed.
+func (a *AllocFS) Watch(alloc *Allocation, path string, pollInterval, debounce time.Duration, cancel <-chan struct{}, q *QueryOptions) (<-chan AllocFileInfo, error) {
+	if pollInterval <= 0 {
+		return nil, fmt.Errorf("pollInterval must be > 0")
+	}
+
+	out := make(chan AllocFileInfo, 1)
+
+	go func() {
+		defer close(out)
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		debounceTimer := a.clock().NewTimer(debounce)
+		debounceTimer.Stop()
+		defer debounceTimer.Stop()
+
+		var pending AllocFileInfo
+		var deleted bool
+		var armed bool
+		var last *AllocFileInfo
+
+		for {
 			select {
 			case <-cancel:
 				return
-			default:
+
+			case <-ticker.C:
+				info, _, err := a.Stat(alloc, path, q)
+				if err != nil {
+					if !isNotFoundError(err) || last == nil {
+						continue
+					}
+					pending = AllocFileInfo{}
+					deleted = true
+					last = nil
+				} else {
+					if last != nil && info.Size == last.Size && info.ModTime.Equal(last.ModTime) {
+						continue
+					}
+					pending = *info
+					deleted = false
+					last = info
+				}
+
+				if armed && !debounceTimer.Stop() {
+					<-debounceTimer.C()
+				}
+				debounceTimer.Reset(debounce)
+				armed = true
+
+			case <-debounceTimer.C():
+				armed = false
+				select {
+				case out <- pending:
+				case <-cancel:
+					return
+				}
+				if deleted {
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// WriteFileTo streams the contents of the file at path into w and returns
+// the file's content type as reported by Stat. This is convenient for
+// uploading alloc files to S3-compatible object storage, where the
+// Content-Type needs to be known up front to set on the PutObject call.
+func (a *AllocFS) WriteFileTo(alloc *Allocation, path string, w io.Writer, q *QueryOptions) (string, error) {
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := a.Cat(alloc, path, q)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return "", err
+	}
+
+	return info.ContentType, nil
+}
+
+// Hash streams the file at path through h and returns the resulting
+// digest, without buffering the file's content in memory or returning it
+// to the caller. This suits integrity manifests that need a file's hash
+// but not its bytes; pass a fresh hash.Hash, e.g. sha256.New().
+func (a *AllocFS) Hash(alloc *Allocation, path string, h hash.Hash, q *QueryOptions) ([]byte, error) {
+	r, err := a.Cat(alloc, path, q)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// IsEmptyFile reports whether the file at path is a legitimate zero-byte
+// file, as opposed to one that is missing or otherwise unreadable. This lets
+// callers distinguish a real empty file (Size == 0, nil error) from a Stat
+// failure rather than inferring emptiness from a zero-length Cat read.
+func (a *AllocFS) IsEmptyFile(alloc *Allocation, path string, q *QueryOptions) (bool, error) {
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return false, err
+	}
+	return info.Size == 0, nil
+}
+
+// downloadRetries is the number of times a single chunk is retried by
+// DownloadResumable before the download is given up on.
+const downloadRetries = 3
+
+// DownloadResumable downloads the file at path in chunkSize pieces using
+// ReadAt, writing each chunk to w as it arrives. A chunk that fails is
+// retried on its own rather than restarting the whole download, so a single
+// transient error over a flaky link doesn't waste everything already
+// fetched. Chunks are written via io.WriterAt so they may land out of order.
+func (a *AllocFS) DownloadResumable(alloc *Allocation, path string, w io.WriterAt, chunkSize int64, q *QueryOptions) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("chunkSize must be positive")
+	}
+
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return err
+	}
+
+	for offset := int64(0); offset < info.Size; offset += chunkSize {
+		limit := chunkSize
+		if remaining := info.Size - offset; remaining < limit {
+			limit = remaining
+		}
+
+		var chunkErr error
+		for attempt := 0; attempt < downloadRetries; attempt++ {
+			chunkErr = a.downloadChunk(alloc, path, offset, limit, w, q)
+			if chunkErr == nil || errors.Is(chunkErr, ErrRangedReadUnsupported) {
+				break
+			}
+		}
+		if errors.Is(chunkErr, ErrRangedReadUnsupported) {
+			return a.downloadWholeFile(alloc, path, w, info.Size, q)
+		}
+		if chunkErr != nil {
+			return fmt.Errorf("failed to download chunk at offset %d: %w", offset, chunkErr)
+		}
+	}
+
+	return nil
+}
+
+// ErrRangedReadUnsupported is returned when a node responds to a ranged
+// ReadAt request with more data than was requested. This happens when the
+// node's handler streams the remainder of the file using chunked transfer
+// encoding instead of honoring offset/limit, typically because it has no
+// Content-Length to report. Range-based, resumable downloads aren't
+// possible against such a node; DownloadResumable falls back to a
+// whole-file download instead of surfacing this error to callers.
+var ErrRangedReadUnsupported = fmt.Errorf("node does not support ranged reads")
+
+// downloadChunk fetches a single chunk of a file via ReadAt and writes it to
+// w at the appropriate offset.
+func (a *AllocFS) downloadChunk(alloc *Allocation, path string, offset, limit int64, w io.WriterAt, q *QueryOptions) error {
+	r, err := a.ReadAt(alloc, path, offset, limit, q)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(buf)) > limit {
+		return ErrRangedReadUnsupported
+	}
+
+	_, err = w.WriteAt(buf, offset)
+	return err
+}
+
+// downloadWholeFile is DownloadResumable's fallback for nodes that don't
+// honor ranged ReadAt requests: it streams the whole file in a single Cat
+// call, retrying from scratch on failure since a chunked,
+// Content-Length-less response can't be resumed partway through.
+func (a *AllocFS) downloadWholeFile(alloc *Allocation, path string, w io.WriterAt, size int64, q *QueryOptions) error {
+	var lastErr error
+	for attempt := 0; attempt < downloadRetries; attempt++ {
+		r, err := a.Cat(alloc, path, q)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		ow := &offsetWriter{w: w}
+		_, err = io.Copy(ow, io.LimitReader(r, size))
+		r.Close()
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+	return fmt.Errorf("failed to download %s without ranged reads: %w", path, lastErr)
+}
+
+// offsetWriter adapts an io.WriterAt into a sequential io.Writer, so
+// io.Copy can drive a stream onto a random-access destination.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.off)
+	o.off += int64(n)
+	return n, err
+}
+
+// ScanArchivedLog reads a gzip-compressed log archive at the given path in an
+// allocation directory and returns its contents decompressed and split into
+// lines, so that rotated logs can be processed the same way as live streamed
+// ones. Archives containing multiple concatenated gzip members are handled
+// transparently.
+func (a *AllocFS) ScanArchivedLog(alloc *Allocation, path string, q *QueryOptions) (<-chan string, <-chan error) {
+	errCh := make(chan error, 1)
+
+	r, err := a.Cat(alloc, path, q)
+	if err != nil {
+		errCh <- err
+		return nil, errCh
+	}
+
+	lines := make(chan string, 10)
+	go func() {
+		defer r.Close()
+		defer close(lines)
+
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer gzr.Close()
+
+		scanner := bufio.NewScanner(gzr)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		if err := scanner.Err(); err != nil {
+			errCh <- err
+		}
+	}()
+
+	return lines, errCh
+}
+
+// Stream streams the content of a file blocking on EOF.
+// The parameters are:
+// * path: path to file to stream.
+// * offset: The offset to start streaming data at.
+// * origin: Either "start" or "end" and defines from where the offset is applied.
+// * cancel: A channel that when closed, streaming will end.
+//
+// The return value is a channel that will emit StreamFrames as they are read.
+//
+// Closing cancel is the only supported way to tear the stream down; simply
+// dropping the returned channel without closing cancel leaves the
+// background goroutine running (it no longer blocks forever trying to send
+// a frame nobody will ever read, but it keeps the underlying connection
+// open and keeps consuming frames from the node until the node itself ends
+// the stream). Callers that would rather tie teardown to a context than
+// manage a cancel channel directly can use StreamCtx instead.
+//
+// If path names a directory, the error channel receives ErrIsDirectory:
+// immediately, via a client-side Stat, if QueryOptions.CheckDirectory is
+// set; otherwise by recognizing the node's own error once the node rejects
+// the request.
+//
+// If QueryOptions.ConnectRetryStatusCodes and ConnectRetryMaxDuration are
+// set, a connect attempt that fails with one of those statuses (a 503 while
+// the node reloads, say) is retried with backoff until ConnectRetryMaxDuration
+// elapses. This only covers getting the stream established; once Stream
+// returns a live channel, interruptions are handled by whatever mid-stream
+// reconnect logic the caller layers on top (see StreamFollow).
+//
+// If QueryOptions.SetupTimeout is set, the node lookup and connect (including
+// any ConnectRetryMaxDuration backoff) are bounded by it: if setup hasn't
+// finished within SetupTimeout, Stream gives up and returns an
+// *ErrStreamSetupTimeout without waiting any further, instead of blocking
+// indefinitely before ever handing back a channel.
+func (a *AllocFS) Stream(alloc *Allocation, path, origin string, offset int64,
+	cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+
+	errCh := make(chan error, 1)
+
+	var (
+		r       io.ReadCloser
+		release func()
+		err     error
+	)
+	if q != nil && q.SetupTimeout > 0 {
+		r, release, err = a.streamSetupWithTimeout("Stream", alloc, path, origin, offset, cancel, q, nil)
+	} else {
+		r, release, err = a.streamSetup("Stream", alloc, path, origin, offset, cancel, q, nil)
+	}
+	if err != nil {
+		errCh <- err
+		return nil, errCh
+	}
+
+	// Create the output channel
+	frames := make(chan *StreamFrame, 10)
+
+	go func() {
+		defer release()
+		defer r.Close()
+		streamJSONFrames(r, cancel, frames, errCh, nil)
+	}()
+
+	return frames, errCh
+}
+
+// streamSetup performs the synchronous portion of Stream: checking for a
+// directory path, reserving a stream slot, and connecting to the node. On
+// success it returns the open response body and the stream slot's release
+// function, both of which the caller owns and must eventually release/close.
+// op names the caller for observe's metrics, and extraParams, if non-nil,
+// is called to set any query params beyond the common path/offset/origin
+// ones, so every caller that streams the node's /fs/stream endpoint --
+// Stream, StreamWithKeepalive, StreamLines, StreamSSE -- shares the same
+// directory check, stream-limit accounting, and connect-retry/timeout
+// handling instead of reimplementing it.
+func (a *AllocFS) streamSetup(op string, alloc *Allocation, path, origin string, offset int64,
+	cancel <-chan struct{}, q *QueryOptions, extraParams func(*QueryOptions)) (io.ReadCloser, func(), error) {
+
+	if q != nil && q.CheckDirectory {
+		if err := a.checkNotDirectory(alloc, path, q); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	release, err := a.acquireStreamSlot(cancel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	reqPath := fmt.Sprintf("/v1/client/fs/stream/%s", alloc.ID)
+	r, err := queryClientNodeWithConnectRetry(a.client, alloc, reqPath, q,
+		func(q *QueryOptions) {
+			q.Params["path"] = path
+			q.Params["offset"] = strconv.FormatInt(offset, 10)
+			q.Params["origin"] = origin
+			if extraParams != nil {
+				extraParams(q)
+			}
+		})
+	a.observe(op, start, err)
+	if err != nil {
+		release()
+		if isDirectoryError(err) {
+			err = fmt.Errorf("%s: %w", path, ErrIsDirectory)
+		}
+		return nil, nil, err
+	}
+
+	return r, release, nil
+}
+
+// ErrStreamSetupTimeout is returned by Stream when QueryOptions.SetupTimeout
+// elapses before the node lookup and connect finish.
+type ErrStreamSetupTimeout struct {
+	Timeout time.Duration
+}
+
+func (e *ErrStreamSetupTimeout) Error() string {
+	return fmt.Sprintf("stream setup did not complete within %s", e.Timeout)
+}
+
+// streamSetupWithTimeout runs streamSetup with a deadline, so a slow node
+// lookup or connect can't block Stream from returning indefinitely. If the
+// deadline elapses first, streamSetup is left running in the background --
+// since there's no way to interrupt it mid-flight -- and whatever it
+// eventually produces is released/closed there instead, since by then
+// nothing will consume it.
+func (a *AllocFS) streamSetupWithTimeout(op string, alloc *Allocation, path, origin string, offset int64,
+	cancel <-chan struct{}, q *QueryOptions, extraParams func(*QueryOptions)) (io.ReadCloser, func(), error) {
+
+	type result struct {
+		r       io.ReadCloser
+		release func()
+		err     error
+	}
+
+	resultCh := make(chan result, 1)
+	go func() {
+		r, release, err := a.streamSetup(op, alloc, path, origin, offset, cancel, q, extraParams)
+		resultCh <- result{r, release, err}
+	}()
+
+	timer := time.NewTimer(q.SetupTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-resultCh:
+		return res.r, res.release, res.err
+	case <-timer.C:
+		go func() {
+			res := <-resultCh
+			if res.release != nil {
+				res.release()
+			}
+			if res.r != nil {
+				res.r.Close()
+			}
+		}()
+		return nil, nil, &ErrStreamSetupTimeout{Timeout: q.SetupTimeout}
+	}
+}
+
+// acquireStreamSlot reserves a slot against streamSem, if a limit has been
+// configured via SetStreamLimit, and returns a function that releases it.
+// If no limit is configured, it returns a no-op release function
+// immediately. Under StreamLimitError, it returns ErrStreamLimitReached
+// without blocking if the limit is already reached.
+func (a *AllocFS) acquireStreamSlot(cancel <-chan struct{}) (func(), error) {
+	if a.streamSem == nil {
+		return func() {}, nil
+	}
+
+	if a.streamLimitPolicy == StreamLimitError {
+		select {
+		case a.streamSem <- struct{}{}:
+			return func() { <-a.streamSem }, nil
+		default:
+			return nil, ErrStreamLimitReached
+		}
+	}
+
+	select {
+	case a.streamSem <- struct{}{}:
+		return func() { <-a.streamSem }, nil
+	case <-cancel:
+		return nil, fmt.Errorf("canceled while waiting for a stream slot")
+	}
+}
+
+// ErrStreamTruncated is returned by a StreamReader's Read once the
+// underlying file is truncated mid-stream: continuing to return bytes at
+// the reader's current offset would silently skip over content written
+// after the truncation, so the read is failed instead. Callers that want
+// to follow through a truncation should use StreamFollow directly.
+var ErrStreamTruncated = fmt.Errorf("stream truncated")
+
+// mergeCancel returns a channel that closes as soon as either a or b
+// closes. A nil input is treated as a channel that never closes.
+func mergeCancel(a, b <-chan struct{}) <-chan struct{} {
+	out := make(chan struct{})
+	go func() {
+		defer close(out)
+		select {
+		case <-a:
+		case <-b:
+		}
+	}()
+	return out
+}
+
+// streamReader adapts Stream's channel of frames into an io.ReadCloser.
+type streamReader struct {
+	pr     *io.PipeReader
+	cancel chan struct{}
+	once   sync.Once
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	return s.pr.Read(p)
+}
+
+// Close stops the underlying stream and unblocks any in-progress Read.
+func (s *streamReader) Close() error {
+	s.once.Do(func() { close(s.cancel) })
+	return s.pr.Close()
+}
+
+// StreamReader is like Stream, but presents the result as a plain
+// io.ReadCloser of concatenated file bytes instead of a channel of
+// StreamFrame values, for the common case of a consumer that immediately
+// discards the frame wrapper and heartbeats. If the file is truncated
+// mid-stream, Read returns ErrStreamTruncated rather than silently
+// skipping the gap. Closing the returned reader cancels the stream.
+func (a *AllocFS) StreamReader(alloc *Allocation, path, origin string, offset int64,
+	cancel <-chan struct{}, q *QueryOptions) (io.ReadCloser, error) {
+
+	innerCancel := make(chan struct{})
+	merged := mergeCancel(cancel, innerCancel)
+
+	frames, errCh := a.Stream(alloc, path, origin, offset, merged, q)
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		for {
+			select {
+			case f, ok := <-frames:
+				if !ok {
+					pw.Close()
+					return
+				}
+				if f.FileEvent == FileEventTruncated {
+					pw.CloseWithError(ErrStreamTruncated)
+					return
+				}
+				if _, err := pw.Write(f.Data); err != nil {
+					return
+				}
+			case err := <-errCh:
+				if err != nil {
+					pw.CloseWithError(err)
+				} else {
+					pw.Close()
+				}
+				return
+			case <-innerCancel:
+				pw.Close()
+				return
+			}
+		}
+	}()
+
+	return &streamReader{pr: pr, cancel: innerCancel}, nil
+}
+
+// StreamCtx is like Stream, but ties teardown to ctx instead of a
+// caller-managed cancel channel, so ctx cancellation is the single
+// teardown path: cancelling ctx is always enough to make the background
+// goroutine stop sending on the returned channels, whether or not the
+// caller is still reading from them.
+func (a *AllocFS) StreamCtx(ctx context.Context, alloc *Allocation, path, origin string, offset int64,
+	q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+
+	cancel := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(cancel)
+	}()
+
+	return a.Stream(alloc, path, origin, offset, cancel, q)
+}
+
+// StreamWithMaxDuration is like Stream, but automatically tears the stream
+// down once maxDuration has elapsed, regardless of how much data has
+// flowed. This bounds long-lived followers (e.g. "tail this log for 5
+// minutes") without requiring the caller to wire up its own timer and
+// cancel channel. A maxDuration <= 0 disables the limit and is equivalent
+// to calling Stream directly.
+//
+// An elapsed MaxDuration closes the returned frames channel without
+// sending anything on the error channel, the same clean-close signal a
+// caller sees when it cancels the stream itself. This lets callers tell
+// "stream cleanly stopped" (including timeout) apart from "stream failed".
+func (a *AllocFS) StreamWithMaxDuration(alloc *Allocation, path, origin string, offset int64,
+	maxDuration time.Duration, cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+
+	if maxDuration <= 0 {
+		return a.Stream(alloc, path, origin, offset, cancel, q)
+	}
+
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(maxDuration, func() { close(timeout) })
+	innerCancel := mergeCancel(cancel, timeout)
+
+	inFrames, inErrs := a.Stream(alloc, path, origin, offset, innerCancel, q)
+
+	frames := make(chan *StreamFrame, 10)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer timer.Stop()
+		defer close(frames)
+
+		for {
+			select {
+			case f, ok := <-inFrames:
+				if !ok {
+					return
+				}
+				select {
+				case frames <- f:
+				case <-cancel:
+					return
+				case <-timeout:
+					return
+				}
+			case err := <-inErrs:
+				if err != nil {
+					errCh <- err
+				}
+				return
+			case <-cancel:
+				return
+			case <-timeout:
+				return
+			}
+		}
+	}()
+
+	return frames, errCh
+}
+
+// StreamWithKeepalive is like Stream, but additionally invokes onHeartbeat
+// every time a heartbeat frame is received instead of silently discarding
+// it. This lets a UI drive a "still connected, no new data" indicator
+// without the frames channel carrying empty heartbeat data.
+func (a *AllocFS) StreamWithKeepalive(alloc *Allocation, path, origin string, offset int64,
+	onHeartbeat func(), cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+
+	errCh := make(chan error, 1)
+
+	var (
+		r       io.ReadCloser
+		release func()
+		err     error
+	)
+	if q != nil && q.SetupTimeout > 0 {
+		r, release, err = a.streamSetupWithTimeout("StreamWithKeepalive", alloc, path, origin, offset, cancel, q, nil)
+	} else {
+		r, release, err = a.streamSetup("StreamWithKeepalive", alloc, path, origin, offset, cancel, q, nil)
+	}
+	if err != nil {
+		errCh <- err
+		return nil, errCh
+	}
+
+	frames := make(chan *StreamFrame, 10)
+
+	go func() {
+		defer release()
+		defer r.Close()
+		streamJSONFrames(r, cancel, frames, errCh, onHeartbeat)
+	}()
+
+	return frames, errCh
+}
+
+// ErrHeartbeatTimeout is sent on StreamWithHeartbeatTimeout's error channel
+// when no heartbeat (or other frame) arrives within the configured timeout.
+var ErrHeartbeatTimeout = fmt.Errorf("heartbeat timeout: no frame received in time")
+
+// StreamWithHeartbeatTimeout is like StreamWithKeepalive, but additionally
+// tears the stream down with ErrHeartbeatTimeout if no frame -- heartbeat or
+// otherwise -- arrives within timeout. This lets a caller detect a node that
+// has silently stopped sending heartbeats (e.g. a hung agent) instead of a
+// cancel-less stream waiting forever. Uses AllocFS's injectable clock, so
+// the timeout can be driven deterministically in tests.
+func (a *AllocFS) StreamWithHeartbeatTimeout(alloc *Allocation, path, origin string, offset int64,
+	timeout time.Duration, cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+
+	innerCancel := make(chan struct{})
+
+	heartbeats := make(chan struct{}, 1)
+	onHeartbeat := func() {
+		select {
+		case heartbeats <- struct{}{}:
+		default:
+		}
+	}
+
+	inFrames, inErrs := a.StreamWithKeepalive(alloc, path, origin, offset, onHeartbeat, innerCancel, q)
+
+	frames := make(chan *StreamFrame, 10)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(innerCancel)
+		defer close(frames)
+
+		timer := a.clock().NewTimer(timeout)
+		defer timer.Stop()
+
+		for {
+			select {
+			case f, ok := <-inFrames:
+				if !ok {
+					return
+				}
+				if !timer.Stop() {
+					<-timer.C()
+				}
+				timer.Reset(timeout)
+
+				select {
+				case frames <- f:
+				case <-cancel:
+					return
+				}
+			case <-heartbeats:
+				if !timer.Stop() {
+					<-timer.C()
+				}
+				timer.Reset(timeout)
+			case err := <-inErrs:
+				if err != nil {
+					errCh <- err
+				}
+				return
+			case <-timer.C():
+				errCh <- ErrHeartbeatTimeout
+				return
+			case <-cancel:
+				return
+			}
+		}
+	}()
+
+	return frames, errCh
+}
+
+// StreamBackpressurePolicy controls what StreamLines does when a consumer
+// falls behind and its lines channel buffer fills up.
+type StreamBackpressurePolicy int
+
+const (
+	// StreamBackpressureBlock pauses delivery until the consumer catches
+	// up, the same as an unbuffered channel send would. This is the
+	// default: it never loses data, but a slow consumer stalls the
+	// underlying node connection.
+	StreamBackpressureBlock StreamBackpressurePolicy = iota
+
+	// StreamBackpressureDropOldest discards the oldest buffered line to
+	// make room for the newest one, so a slow consumer always sees the
+	// most recent output at the cost of a gap in the middle.
+	StreamBackpressureDropOldest
+
+	// StreamBackpressureDropNewest discards the incoming line instead of
+	// blocking, leaving the buffered backlog untouched.
+	StreamBackpressureDropNewest
+)
+
+// String returns p's constant name, for logging.
+func (p StreamBackpressurePolicy) String() string {
+	switch p {
+	case StreamBackpressureDropOldest:
+		return "drop-oldest"
+	case StreamBackpressureDropNewest:
+		return "drop-newest"
+	default:
+		return "block"
+	}
+}
+
+// StreamConfig customizes how StreamLines requests frames from the node.
+type StreamConfig struct {
+	// RequestLineDelimited asks the node to align frame boundaries on
+	// newlines, via the stream endpoint's line_delimited parameter, so
+	// line-oriented consumers don't have to reassemble partial lines
+	// themselves. Nodes that don't recognize the parameter simply ignore
+	// it and keep framing on their usual boundaries.
+	RequestLineDelimited bool
+
+	// SanitizeUTF8 replaces any invalid UTF-8 byte sequences in each line
+	// with the Unicode replacement character before it's delivered. Binary
+	// or otherwise non-UTF-8 log content can otherwise corrupt a terminal
+	// or break a consumer that assumes valid text. Off by default so
+	// StreamLines keeps handing back raw bytes unmodified unless a caller
+	// opts in.
+	SanitizeUTF8 bool
+
+	// BackpressurePolicy controls what happens when the consumer reading
+	// StreamLines's returned channel falls behind and its buffer fills
+	// up. Defaults to StreamBackpressureBlock, preserving the original
+	// behavior of never dropping a line.
+	BackpressurePolicy StreamBackpressurePolicy
+
+	// OnDrop, if non-nil, is called every time BackpressurePolicy causes a
+	// line to be dropped, with the cumulative number of lines dropped so
+	// far. It is never called under StreamBackpressureBlock. This is the
+	// consumer's only way to learn that delivery is lossy, since the
+	// lines channel itself gives no indication a gap occurred.
+	OnDrop func(dropped int)
+
+	// Diagnostics, if set, receives one human-readable line per stream
+	// lifecycle event that isn't itself an error -- a dropped line under
+	// BackpressurePolicy, or a heartbeat arriving after a gap with no data
+	// frames. This keeps such notices off the error channel, which is
+	// reserved for failures, while still giving a caller that wants to
+	// surface them (e.g. in a status line) somewhere to read them from.
+	// StreamFollowWithDiagnostics writes its own reconnect notices to the
+	// same writer.
+	Diagnostics io.Writer
+}
+
+// logDiagnostic writes a formatted line to cfg.Diagnostics, if set, doing
+// nothing otherwise. It's the shared chokepoint every StreamConfig
+// diagnostic note goes through, so callers never need their own nil check.
+func (cfg StreamConfig) logDiagnostic(format string, args ...interface{}) {
+	if cfg.Diagnostics == nil {
+		return
+	}
+	fmt.Fprintf(cfg.Diagnostics, format+"\n", args...)
+}
+
+// StreamLines is like Stream, but delivers complete lines instead of raw
+// frames. If cfg.RequestLineDelimited is set, it asks the node to align its
+// frames on newline boundaries; lines are reassembled client-side either
+// way, so correctness never depends on whether the node actually honors
+// the hint. If onFrameBoundary is non-nil, it's called once per raw frame
+// received with whether that frame's payload happened to end on a newline,
+// so a caller can tell whether the node honored the request or StreamLines
+// fell back to full client-side reassembly.
+func (a *AllocFS) StreamLines(alloc *Allocation, path, origin string, offset int64, cfg StreamConfig,
+	onFrameBoundary func(endsOnNewline bool), cancel <-chan struct{}, q *QueryOptions) (<-chan string, <-chan error) {
+
+	errCh := make(chan error, 1)
+
+	extraParams := func(q *QueryOptions) {
+		if cfg.RequestLineDelimited {
+			q.Params["line_delimited"] = "true"
+		}
+	}
+
+	var (
+		r       io.ReadCloser
+		release func()
+		err     error
+	)
+	if q != nil && q.SetupTimeout > 0 {
+		r, release, err = a.streamSetupWithTimeout("StreamLines", alloc, path, origin, offset, cancel, q, extraParams)
+	} else {
+		r, release, err = a.streamSetup("StreamLines", alloc, path, origin, offset, cancel, q, extraParams)
+	}
+	if err != nil {
+		errCh <- err
+		return nil, errCh
+	}
+
+	rawFrames := make(chan *StreamFrame, 10)
+	frameErrs := make(chan error, 1)
+
+	// lastHeartbeat is only ever touched from the streamJSONFrames goroutine
+	// below, via onHeartbeat, so it needs no synchronization of its own.
+	lastHeartbeat := time.Now()
+	onHeartbeat := func() {
+		if cfg.Diagnostics == nil {
+			return
+		}
+		gap := time.Since(lastHeartbeat)
+		lastHeartbeat = time.Now()
+		cfg.logDiagnostic("heartbeat received, %s since the previous one", gap.Round(time.Millisecond))
+	}
+
+	go func() {
+		defer release()
+		defer r.Close()
+		streamJSONFrames(r, cancel, rawFrames, frameErrs, onHeartbeat)
+	}()
+
+	// Tap each frame to report boundary alignment to the caller before
+	// handing it to the reassembling reader below.
+	tapped := make(chan *StreamFrame, 10)
+	go func() {
+		defer close(tapped)
+		for f := range rawFrames {
+			if onFrameBoundary != nil {
+				onFrameBoundary(len(f.Data) > 0 && f.Data[len(f.Data)-1] == '\n')
+			}
+			tapped <- f
+		}
+	}()
+
+	lines := make(chan string, 10)
+	go func() {
+		defer close(lines)
+
+		fr := NewFrameReader(tapped, frameErrs, make(chan struct{}))
+		defer fr.Close()
+
+		var dropped int
+		scanner := bufio.NewScanner(fr)
+		for scanner.Scan() {
+			select {
+			case <-cancel:
+				return
+			default:
+			}
+			line := scanner.Text()
+			if cfg.SanitizeUTF8 {
+				line = strings.ToValidUTF8(line, string(utf8.RuneError))
+			}
+
+			switch cfg.BackpressurePolicy {
+			case StreamBackpressureDropNewest:
+				select {
+				case lines <- line:
+				default:
+					dropped++
+					if cfg.OnDrop != nil {
+						cfg.OnDrop(dropped)
+					}
+					cfg.logDiagnostic("dropped newest line, consumer buffer full (%d dropped so far)", dropped)
+				}
+			case StreamBackpressureDropOldest:
+				select {
+				case lines <- line:
+				default:
+					select {
+					case <-lines:
+					default:
+					}
+					select {
+					case lines <- line:
+					default:
+					}
+					dropped++
+					if cfg.OnDrop != nil {
+						cfg.OnDrop(dropped)
+					}
+					cfg.logDiagnostic("dropped oldest buffered line to make room, consumer buffer full (%d dropped so far)", dropped)
+				}
+			default:
+				lines <- line
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			errCh <- err
+		}
+	}()
+
+	return lines, errCh
+}
+
+// splitOnDelim returns a bufio.SplitFunc that splits on delim the way
+// bufio.ScanLines splits on '\n', for ScanDelim.
+func splitOnDelim(delim byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.IndexByte(data, delim); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// ScanDelim is like StreamLines, but splits the stream on an arbitrary
+// delim byte instead of newlines, reassembling records across frame
+// boundaries the same way StreamLines reassembles lines. This supports
+// record-oriented log formats that use a custom separator, such as
+// NUL-delimited output.
+func (a *AllocFS) ScanDelim(alloc *Allocation, path string, delim byte, cancel <-chan struct{}, q *QueryOptions) (<-chan string, <-chan error) {
+	frames, frameErrs := a.Stream(alloc, path, OriginStart, 0, cancel, q)
+
+	records := make(chan string, 10)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(records)
+
+		fr := NewFrameReader(frames, frameErrs, make(chan struct{}))
+		defer fr.Close()
+
+		scanner := bufio.NewScanner(fr)
+		scanner.Split(splitOnDelim(delim))
+		for scanner.Scan() {
+			select {
+			case <-cancel:
+				return
+			default:
+			}
+			records <- scanner.Text()
+		}
+		if err := scanner.Err(); err != nil {
+			errCh <- err
+		}
+	}()
+
+	return records, errCh
+}
+
+// StreamGrep is like StreamLines, but only delivers lines matching re (or,
+// if invert is true, lines that don't match). Nomad's stream endpoint has
+// no server-side filter parameter, so this always reassembles lines and
+// matches them client-side; it exists to save a consumer from wiring up
+// its own regexp check on top of StreamLines, not to save bandwidth to the
+// node.
+func (a *AllocFS) StreamGrep(alloc *Allocation, path string, re *regexp.Regexp, invert bool, cancel <-chan struct{}, q *QueryOptions) (<-chan string, <-chan error) {
+	allLines, errCh := a.StreamLines(alloc, path, OriginStart, 0, StreamConfig{}, nil, cancel, q)
+
+	matched := make(chan string, 10)
+	go func() {
+		defer close(matched)
+		for line := range allLines {
+			if re.MatchString(line) == !invert {
+				select {
+				case matched <- line:
+				case <-cancel:
+					return
+				}
+			}
+		}
+	}()
+
+	return matched, errCh
+}
+
+// ChunkedReader is like ScanDelim, but instead of splitting on a
+// delimiter, it delivers the streamed file as fixed-size byte chunks of
+// exactly chunkSize, with the final chunk shorter if the file's length
+// isn't a multiple of chunkSize. This decouples the node's own framing
+// from whatever block size a downstream consumer -- such as a chunked
+// upload to object storage -- requires.
+//
+// Closing cancel ends the stream early, the same way it does for Stream.
+func (a *AllocFS) ChunkedReader(alloc *Allocation, path string, chunkSize int, cancel <-chan struct{}, q *QueryOptions) (<-chan []byte, <-chan error) {
+	chunks := make(chan []byte, 10)
+	errCh := make(chan error, 1)
+
+	if chunkSize <= 0 {
+		errCh <- fmt.Errorf("chunkSize must be > 0")
+		close(chunks)
+		return chunks, errCh
+	}
+
+	frames, frameErrs := a.Stream(alloc, path, OriginStart, 0, cancel, q)
+
+	go func() {
+		defer close(chunks)
+
+		fr := NewFrameReader(frames, frameErrs, make(chan struct{}))
+		defer fr.Close()
+
+		for {
+			buf := make([]byte, chunkSize)
+			n, err := io.ReadFull(fr, buf)
+			if n > 0 {
+				select {
+				case chunks <- buf[:n]:
+				case <-cancel:
+					return
+				}
+			}
+			if err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					return
+				}
+				errCh <- err
+				return
+			}
+		}
+	}()
+
+	return chunks, errCh
+}
+
+// Lines follows the file at path, yielding one complete reassembled line
+// at a time to yield, honoring ctx cancellation and stopping as soon as
+// yield returns false. If follow is false, Lines stops cleanly once the
+// file's current EOF is reached; if follow is true, it keeps waiting for
+// new lines until ctx is done. The final call to yield, if any, carries
+// a non-nil error (ctx.Err() or a stream error) and an empty line.
+//
+// The shape of the returned function, func(yield func(string, error)
+// bool), intentionally matches iter.Seq2[string, error] from the
+// standard library "iter" package. This module is kept compatible with
+// Go 1.12, which predates range-over-func, so callers on this module
+// must drive it manually:
+//
+//	it := allocFS.Lines(ctx, alloc, "alloc/logs/task.stdout.0", true, nil)
+//	it(func(line string, err error) bool {
+//		if err != nil {
+//			return false
+//		}
+//		fmt.Println(line)
+//		return true
+//	})
+//
+// Callers on a newer Go module are free to use it with native
+// `for line, err := range allocFS.Lines(...)` syntax instead.
+func (a *AllocFS) Lines(ctx context.Context, alloc *Allocation, path string, follow bool, q *QueryOptions) func(yield func(string, error) bool) {
+	return func(yield func(string, error) bool) {
+		cancel := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				close(cancel)
+			case <-done:
+			}
+		}()
+		defer close(done)
+
+		lines, errCh := a.StreamLines(alloc, path, OriginStart, 0, StreamConfig{}, nil, cancel, q)
+
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					if !follow {
+						return
+					}
+					// The underlying stream ended (e.g. the node closed the
+					// connection); surface it as an error rather than
+					// silently stopping a follow.
+					select {
+					case err := <-errCh:
+						yield("", err)
+					default:
+						yield("", io.ErrUnexpectedEOF)
+					}
+					return
+				}
+				if !yield(line, nil) {
+					return
+				}
+			case err := <-errCh:
+				yield("", err)
+				return
+			case <-ctx.Done():
+				yield("", ctx.Err())
+				return
+			}
+		}
+	}
+}
+
+// streamJSONFrames decodes newline-delimited JSON StreamFrames from r,
+// sending each non-heartbeat frame on frames, until cancel is closed or
+// decoding ends. A clean end of stream (connection closed after the follow
+// ended, or the handler hung up normally) is not an error condition; only
+// abnormal disconnects are sent on errCh, so callers don't mistake a dropped
+// connection for a clean end-of-log. frames is always closed before return.
+// If onHeartbeat is non-nil, it is called for every heartbeat frame received
+// instead of delivering it, so a caller can drive a liveness indicator
+// without the frames channel carrying empty data.
+func streamJSONFrames(r io.Reader, cancel <-chan struct{}, frames chan<- *StreamFrame, errCh chan<- error, onHeartbeat func()) {
+	dec := json.NewDecoder(r)
+
+	for {
+		select {
+		case <-cancel:
+			return
+		default:
+		}
+
+		var frame StreamFrame
+		if err := dec.Decode(&frame); err != nil {
+			if err != io.EOF && err != io.ErrClosedPipe {
+				errCh <- err
+			}
+			close(frames)
+			return
+		}
+
+		if frame.IsHeartbeat() {
+			if onHeartbeat != nil {
+				onHeartbeat()
+			}
+			continue
+		}
+
+		select {
+		case frames <- &frame:
+		case <-cancel:
+			return
+		}
+	}
+}
+
+// streamSSEFrames parses r as a Server-Sent Events stream, decoding the JSON
+// payload of each "data:" field into a StreamFrame and sending
+// non-heartbeat frames on frames. It is used as a fallback framing for nodes
+// that prefer SSE over newline-delimited JSON. frames is always closed
+// before return.
+func streamSSEFrames(r io.Reader, cancel <-chan struct{}, frames chan<- *StreamFrame, errCh chan<- error) {
+	scanner := bufio.NewScanner(r)
+	var data bytes.Buffer
+
+	flush := func() bool {
+		if data.Len() == 0 {
+			return true
+		}
+		var frame StreamFrame
+		err := json.Unmarshal(data.Bytes(), &frame)
+		data.Reset()
+		if err != nil {
+			errCh <- err
+			close(frames)
+			return false
+		}
+		if !frame.IsHeartbeat() {
+			select {
+			case frames <- &frame:
+			case <-cancel:
+				return false
+			}
+		}
+		return true
+	}
+
+	for scanner.Scan() {
+		select {
+		case <-cancel:
+			return
+		default:
+		}
+
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if !flush() {
+				return
+			}
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(line, "data:"))
+		}
+	}
+
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		errCh <- err
+	}
+	close(frames)
+}
+
+// StreamSSE behaves like Stream, but asks the node to frame the response as
+// Server-Sent Events instead of newline-delimited JSON, which suits
+// browser-adjacent proxies that buffer SSE differently. If the node doesn't
+// support SSE framing and responds with the regular JSON stream instead,
+// StreamSSE detects this and falls back to parsing it transparently.
+func (a *AllocFS) StreamSSE(alloc *Allocation, path, origin string, offset int64,
+	cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+
+	errCh := make(chan error, 1)
+
+	extraParams := func(q *QueryOptions) {
+		q.Params["accept"] = "text/event-stream"
+	}
+
+	var (
+		r       io.ReadCloser
+		release func()
+		err     error
+	)
+	if q != nil && q.SetupTimeout > 0 {
+		r, release, err = a.streamSetupWithTimeout("StreamSSE", alloc, path, origin, offset, cancel, q, extraParams)
+	} else {
+		r, release, err = a.streamSetup("StreamSSE", alloc, path, origin, offset, cancel, q, extraParams)
+	}
+	if err != nil {
+		errCh <- err
+		return nil, errCh
+	}
+
+	frames := make(chan *StreamFrame, 10)
+
+	go func() {
+		defer release()
+		defer r.Close()
+
+		br := bufio.NewReader(r)
+		peek, _ := br.Peek(5)
+
+		if bytes.HasPrefix(peek, []byte("data:")) || bytes.HasPrefix(peek, []byte("event")) {
+			streamSSEFrames(br, cancel, frames, errCh)
+			return
+		}
+
+		streamJSONFrames(br, cancel, frames, errCh, nil)
+	}()
+
+	return frames, errCh
+}
+
+// StreamState enumerates why a Stream's frames channel was closed.
+type StreamState int
+
+const (
+	// StreamStateUnknown is the zero value and is never sent on a
+	// StreamResult channel.
+	StreamStateUnknown StreamState = iota
+
+	// StreamStateEOF indicates the stream ended cleanly.
+	StreamStateEOF
+
+	// StreamStateError indicates the stream ended because of an error,
+	// such as an abnormal disconnect.
+	StreamStateError
+
+	// StreamStateCancelled indicates the caller closed the cancel channel.
+	StreamStateCancelled
+)
+
+func (s StreamState) String() string {
+	switch s {
+	case StreamStateEOF:
+		return "eof"
+	case StreamStateError:
+		return "error"
+	case StreamStateCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// StreamResult describes how a StreamWithResult call ended.
+type StreamResult struct {
+	State StreamState
+	Err   error
+}
+
+// StreamWithResult behaves like Stream, but instead of requiring the caller
+// to infer why the frames channel closed from the separate error channel,
+// it reports a single typed StreamResult once the stream ends.
+func (a *AllocFS) StreamWithResult(alloc *Allocation, path, origin string, offset int64,
+	cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan StreamResult) {
+
+	frames, errCh := a.Stream(alloc, path, origin, offset, cancel, q)
+
+	out := make(chan *StreamFrame, 10)
+	result := make(chan StreamResult, 1)
+
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case f, ok := <-frames:
+				if !ok {
+					result <- StreamResult{State: StreamStateEOF}
+					return
+				}
+				out <- f
+			case err := <-errCh:
+				result <- StreamResult{State: StreamStateError, Err: err}
+				return
+			case <-cancel:
+				result <- StreamResult{State: StreamStateCancelled}
+				return
+			}
+		}
+	}()
+
+	return out, result
+}
+
+const (
+	// nodeStartupRetryInitialDelay, nodeStartupRetryMaxDelay, and
+	// nodeStartupMaxAttempts bound the backoff used by queryClientNode when
+	// QueryOptions.NodeStartupTimeout is set.
+	nodeStartupRetryInitialDelay = 250 * time.Millisecond
+	nodeStartupRetryMaxDelay     = 2 * time.Second
+	nodeStartupMaxAttempts       = 10
+)
+
+// isNotFoundError reports whether err is the "Unexpected response code: 404"
+// error produced when a request's response status isn't 200.
+func isNotFoundError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Unexpected response code: 404")
+}
+
+// isStatusCodeError reports whether err is the "Unexpected response code: N"
+// error produced when a request's response status isn't 200, for any N in
+// codes.
+func isStatusCodeError(err error, codes []int) bool {
+	if err == nil {
+		return false
+	}
+	for _, code := range codes {
+		if strings.Contains(err.Error(), fmt.Sprintf("Unexpected response code: %d", code)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrNodeVersionTooOld is returned by RequireNodeVersion when the target
+// node's Nomad version is older than a requested feature needs.
+type ErrNodeVersionTooOld struct {
+	Feature         string
+	RequiredVersion string
+	NodeVersion     string
+}
+
+func (e *ErrNodeVersionTooOld) Error() string {
+	return fmt.Sprintf("feature %q requires node version >= %s, node is running %s",
+		e.Feature, e.RequiredVersion, e.NodeVersion)
+}
+
+// compareVersions compares two dotted version strings (e.g. "1.6.2")
+// numerically, component by component, ignoring any "+build" or
+// "-prerelease" suffix on either side. It returns -1, 0, or 1 the way
+// strings.Compare does. Missing trailing components compare as 0, so
+// "1.6" == "1.6.0". This is intentionally a minimal comparison rather than
+// a full semver parse, to avoid taking on a version-parsing dependency
+// just to gate a feature by node version.
+func compareVersions(a, b string) int {
+	trim := func(s string) string {
+		if i := strings.IndexAny(s, "+-"); i != -1 {
+			s = s[:i]
+		}
+		return s
+	}
+
+	aParts := strings.Split(trim(a), ".")
+	bParts := strings.Split(trim(b), ".")
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var av, bv int
+		if i < len(aParts) {
+			av, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bv, _ = strconv.Atoi(bParts[i])
+		}
+		if av != bv {
+			if av < bv {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// nodeVersion returns alloc's node's "nomad.version" attribute, caching the
+// result per NodeID for up to nodeVersionCacheTTL so repeated
+// RequireNodeVersion calls against the same node don't re-fetch node info
+// every time.
+func (a *AllocFS) nodeVersion(alloc *Allocation, q *QueryOptions) (string, error) {
+	now := a.clock().Now()
+
+	a.nodeVersionsMu.Lock()
+	entry, ok := a.nodeVersions[alloc.NodeID]
+	a.nodeVersionsMu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.version, nil
+	}
+
+	node, _, err := a.client.Nodes().Info(alloc.NodeID, q)
+	if err != nil {
+		return "", err
+	}
+	v := node.Attributes["nomad.version"]
+
+	a.nodeVersionsMu.Lock()
+	if a.nodeVersions == nil {
+		a.nodeVersions = make(map[string]*nodeVersionCacheEntry)
+	}
+	a.nodeVersions[alloc.NodeID] = &nodeVersionCacheEntry{version: v, expiresAt: now.Add(nodeVersionCacheTTL)}
+	a.nodeVersionsMu.Unlock()
+
+	return v, nil
+}
+
+// InvalidateNodeVersion evicts the cached "nomad.version" entry for nodeID,
+// if any, so the next RequireNodeVersion call against that node re-fetches
+// it instead of waiting out nodeVersionCacheTTL. Useful when a caller
+// already knows a node was upgraded, e.g. from a node update event.
+func (a *AllocFS) InvalidateNodeVersion(nodeID string) {
+	a.nodeVersionsMu.Lock()
+	delete(a.nodeVersions, nodeID)
+	a.nodeVersionsMu.Unlock()
+}
+
+// RequireNodeVersion looks up alloc's node version (cached per node via
+// nodeVersion) and returns an *ErrNodeVersionTooOld identifying feature if
+// the node is older than minVersion, so a caller can fail fast with a
+// clear message instead of hitting a confusing failure further down from
+// trying to use a feature the node doesn't support. If the node's version
+// attribute is missing or unparseable, RequireNodeVersion does not block
+// the caller: it assumes the node is compatible rather than risk false
+// positives against an attribute it can't read.
+func (a *AllocFS) RequireNodeVersion(alloc *Allocation, feature, minVersion string, q *QueryOptions) error {
+	v, err := a.nodeVersion(alloc, q)
+	if err != nil {
+		return err
+	}
+
+	if v == "" {
+		return nil
+	}
+
+	if compareVersions(v, minVersion) < 0 {
+		return &ErrNodeVersionTooOld{Feature: feature, RequiredVersion: minVersion, NodeVersion: v}
+	}
+
+	return nil
+}
+
+// queryClientNodeWithConnectRetry wraps queryClientNode, retrying the whole
+// connect attempt with backoff if q.ConnectRetryMaxDuration and
+// q.ConnectRetryStatusCodes are set and the attempt fails with one of those
+// statuses. It only covers the initial connect: once queryClientNode
+// succeeds and hands back a stream, any further interruption is up to the
+// caller's own mid-stream reconnect logic.
+func queryClientNodeWithConnectRetry(c *Client, alloc *Allocation, reqPath string, q *QueryOptions, customizeQ func(*QueryOptions)) (io.ReadCloser, error) {
+	if q == nil || q.ConnectRetryMaxDuration <= 0 || len(q.ConnectRetryStatusCodes) == 0 {
+		return queryClientNode(c, alloc, reqPath, q, customizeQ)
+	}
+
+	deadline := time.Now().Add(q.ConnectRetryMaxDuration)
+	delay := nodeStartupRetryInitialDelay
+
+	for {
+		r, err := queryClientNode(c, alloc, reqPath, q, customizeQ)
+		if err == nil || !isStatusCodeError(err, q.ConnectRetryStatusCodes) {
+			return r, err
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return r, err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+		if delay > nodeStartupRetryMaxDelay {
+			delay = nodeStartupRetryMaxDelay
+		}
+	}
+}
+
+// newRequestID returns an opaque, random correlation token for
+// QueryOptions.RequestID. It isn't an RFC 4122 UUID -- just random hex --
+// since all it needs to do is be unique enough to grep an agent's logs for.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand.Read on a real OS doesn't fail; if it somehow does,
+		// fall back to a value derived from the current time so callers
+		// still get something to log rather than an empty header.
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%x", b)
+}
+
+// queryClientNode performs reqPath against alloc's node, retrying with
+// backoff for up to q.NodeStartupTimeout if the failure looks like the
+// transient window right after placement: the node hasn't advertised an
+// address yet, or the path 404s. A 404 that persists past
+// nodeStartupMaxAttempts is treated as permanent rather than retried
+// indefinitely.
+func queryClientNode(c *Client, alloc *Allocation, reqPath string, q *QueryOptions, customizeQ func(*QueryOptions)) (io.ReadCloser, error) {
+	if q == nil || q.NodeStartupTimeout <= 0 {
+		return queryClientNodeOnce(c, alloc, reqPath, q, customizeQ)
+	}
+
+	deadline := time.Now().Add(q.NodeStartupTimeout)
+	delay := nodeStartupRetryInitialDelay
+
+	var r io.ReadCloser
+	var err error
+	for attempt := 0; attempt < nodeStartupMaxAttempts; attempt++ {
+		r, err = queryClientNodeOnce(c, alloc, reqPath, q, customizeQ)
+		if err == nil {
+			return r, nil
+		}
+		if !errors.Is(err, ErrNodeAddrNotAdvertised) && !isNotFoundError(err) {
+			return nil, err
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return nil, err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+		if delay > nodeStartupRetryMaxDelay {
+			delay = nodeStartupRetryMaxDelay
+		}
+	}
+
+	return r, err
+}
+
+func queryClientNodeOnce(c *Client, alloc *Allocation, reqPath string, q *QueryOptions, customizeQ func(*QueryOptions)) (io.ReadCloser, error) {
+	if c.config.ProxyBaseURL != "" {
+		if q == nil {
+			q = &QueryOptions{}
+		}
+		if q.Params == nil {
+			q.Params = make(map[string]string)
+		}
+		if q.RequestID == "" {
+			q.RequestID = newRequestID()
+		}
+		if customizeQ != nil {
+			customizeQ(q)
+		}
+		return queryThroughProxy(c, alloc, reqPath, q)
+	}
+
+	// GetNodeClientWithTimeout issues its own request (to look up the
+	// node) using q, so it must run before customizeQ mutates q's params
+	// for the fs request itself -- otherwise the node lookup would pick
+	// up params (like "path") that only make sense for the fs request.
+	nodeClient, nodeErr := c.GetNodeClientWithTimeout(alloc.NodeID, ClientConnTimeout, q)
+
+	if q == nil {
+		q = &QueryOptions{}
+	}
+	if q.Params == nil {
+		q.Params = make(map[string]string)
+	}
+	if q.RequestID == "" {
+		q.RequestID = newRequestID()
+	}
+	if customizeQ != nil {
+		customizeQ(q)
+	}
+
+	if nodeClient == nil && q.NodeStartupTimeout > 0 && errors.Is(nodeErr, ErrNodeAddrNotAdvertised) {
+		return nil, nodeErr
+	}
+
+	var r io.ReadCloser
+	var err error
+
+	if nodeClient != nil {
+		r, err = nodeClient.rawQueryRetryable(reqPath, q)
+		if isTLSHandshakeError(err) {
+			// Our cached scheme for this node was wrong; flip it to the
+			// opposite of what we just tried, and retry once now before
+			// falling back to the server.
+			triedTLS := strings.HasPrefix(nodeClient.config.Address, "https://")
+			c.flipNodeScheme(alloc.NodeID, triedTLS)
+			if retryClient, rerr := c.GetNodeClientWithTimeout(alloc.NodeID, ClientConnTimeout, q); rerr == nil && retryClient != nil {
+				r, err = retryClient.rawQueryRetryable(reqPath, q)
+			}
+		}
+		if _, ok := err.(net.Error); err != nil && !ok {
+			// found a non networking error talking to client directly
+			return nil, err
+		}
+
+	}
+
+	// failed to query node, access through server directly
+	// or network error when talking to the client directly
+	if r == nil {
+		return c.rawQueryRetryable(reqPath, q)
+	}
+
+	return r, err
+}
+
+// queryThroughProxy issues reqPath against c.config.ProxyBaseURL instead of
+// dialing alloc's node directly, adding the node ID as a query parameter so
+// the proxy knows which node to fetch (or serve from cache) for. It skips
+// the node lookup queryClientNodeOnce would otherwise do, since resolving
+// the node's address is the proxy's job, not the caller's.
+func queryThroughProxy(c *Client, alloc *Allocation, reqPath string, q *QueryOptions) (io.ReadCloser, error) {
+	proxyConf := c.config
+	proxyConf.Address = c.config.ProxyBaseURL
+	proxyConf.ProxyBaseURL = ""
+
+	proxyClient, err := NewClient(&proxyConf)
+	if err != nil {
+		return nil, err
+	}
+	proxyClient.baseCtx = c.baseCtx
+
+	q.Params["node"] = alloc.NodeID
+	return proxyClient.rawQueryRetryable(reqPath, q)
+}
+
+// Logs streams the content of a tasks logs blocking on EOF.
+// The parameters are:
+// * allocation: the allocation to stream from.
+// * follow: Whether the logs should be followed.
+// * task: the tasks name to stream logs for.
+// * logType: Either "stdout" or "stderr"
+// * origin: Either "start" or "end" and defines from where the offset is applied.
+// * offset: The offset to start streaming data at.
+// * cancel: A channel that when closed, streaming will end.
+//
+// The return value is a channel that will emit StreamFrames as they are read.
+// The chan will be closed when follow=false and the end of the file is
+// reached.
+//
+// Unexpected (non-EOF) errors will be sent on the error chan.
+func (a *AllocFS) Logs(alloc *Allocation, follow bool, task, logType, origin string,
+	offset int64, cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+
+	errCh := make(chan error, 1)
+
+	reqPath := fmt.Sprintf("/v1/client/fs/logs/%s", alloc.ID)
+	r, err := queryClientNode(a.client, alloc, reqPath, q,
+		func(q *QueryOptions) {
+			q.Params["follow"] = strconv.FormatBool(follow)
+			q.Params["task"] = task
+			q.Params["type"] = logType
+			q.Params["origin"] = origin
+			q.Params["offset"] = strconv.FormatInt(offset, 10)
+		})
+	if err != nil {
+		errCh <- err
+		return nil, errCh
+	}
+
+	// Create the output channel
+	frames := make(chan *StreamFrame, 10)
+
+	go func() {
+		// Close the body
+		defer r.Close()
+
+		// Create a decoder
+		dec := json.NewDecoder(r)
+
+		for {
+			// Check if we have been cancelled
+			select {
+			case <-cancel:
+				return
+			default:
+			}
+
+			// Decode the next frame
+			var frame StreamFrame
+			if err := dec.Decode(&frame); err != nil {
+				if err == io.EOF || err == io.ErrClosedPipe {
+					close(frames)
+				} else {
+					errCh <- err
+				}
+				return
+			}
+
+			// Discard heartbeat frames
+			if frame.IsHeartbeat() {
+				continue
+			}
+
+			frames <- &frame
+		}
+	}()
+
+	return frames, errCh
+}
+
+// TimestampFormat controls how LogsLinesTimestamped renders the receive
+// time it prepends to each line.
+type TimestampFormat int
+
+const (
+	// TimestampRFC3339 renders timestamps like "2006-01-02T15:04:05Z07:00".
+	TimestampRFC3339 TimestampFormat = iota
+
+	// TimestampUnix renders timestamps as a Unix seconds count.
+	TimestampUnix
+)
+
+func (f TimestampFormat) format(t time.Time) string {
+	switch f {
+	case TimestampUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	default:
+		return t.Format(time.RFC3339)
+	}
+}
+
+// LogsLinesTimestamped is like Logs, but reassembles frames into complete
+// lines and prepends each with the time the client received it, rendered
+// in format and separated from the line by a single space. The timestamp
+// is best-effort: it reflects when the client observed the line, not when
+// the task wrote it, since log frames don't currently carry a node-side
+// write time. Callers that need write-time precision should treat this as
+// an approximation suitable for rough event correlation, not an audit
+// trail.
+func (a *AllocFS) LogsLinesTimestamped(alloc *Allocation, follow bool, task, logType, origin string,
+	offset int64, format TimestampFormat, cancel <-chan struct{}, q *QueryOptions) (<-chan string, <-chan error) {
+
+	frames, frameErrs := a.Logs(alloc, follow, task, logType, origin, offset, cancel, q)
+
+	lines := make(chan string, 10)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(lines)
+
+		fr := NewFrameReader(frames, frameErrs, make(chan struct{}))
+		defer fr.Close()
+
+		scanner := bufio.NewScanner(fr)
+		for scanner.Scan() {
+			select {
+			case <-cancel:
+				return
+			default:
+			}
+			lines <- format.format(time.Now()) + " " + scanner.Text()
+		}
+		if err := scanner.Err(); err != nil {
+			errCh <- err
+		}
+	}()
+
+	return lines, errCh
+}
+
+// assertLogMatchesContextLines is how many of the most recently seen lines
+// AssertLogMatches includes in its timeout error, to give a failing test
+// enough context to diagnose what the task actually logged.
+const assertLogMatchesContextLines = 10
+
+// AssertLogMatches follows a task's log, returning nil as soon as a line
+// matches re, or a descriptive error once timeout elapses without a match.
+// The timeout error includes the last few lines seen, so a failing test
+// doesn't just learn "no match" -- it learns what the task actually logged
+// instead. This is a purpose-built helper for test harnesses that need to
+// wait for something like "listening on" in a task's output before moving
+// on, built on top of Logs rather than requiring each test to wire up its
+// own streaming and matching.
+func (a *AllocFS) AssertLogMatches(alloc *Allocation, task, logType string, re *regexp.Regexp, timeout time.Duration, q *QueryOptions) error {
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, frameErrs := a.Logs(alloc, true, task, logType, OriginStart, 0, cancel, q)
+
+	lines := make(chan string, 10)
+	scanErrs := make(chan error, 1)
+	go func() {
+		defer close(lines)
+
+		fr := NewFrameReader(frames, frameErrs, make(chan struct{}))
+		defer fr.Close()
+
+		scanner := bufio.NewScanner(fr)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		if err := scanner.Err(); err != nil {
+			scanErrs <- err
+		}
+	}()
+
+	timer := a.clock().NewTimer(timeout)
+	defer timer.Stop()
+
+	var recent []string
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return fmt.Errorf("log ended without a match for %q", re.String())
+			}
+			recent = append(recent, line)
+			if len(recent) > assertLogMatchesContextLines {
+				recent = recent[len(recent)-assertLogMatchesContextLines:]
+			}
+			if re.MatchString(line) {
+				return nil
+			}
+		case err := <-scanErrs:
+			return err
+		case <-timer.C():
+			return fmt.Errorf("timed out after %s waiting for log to match %q, last lines seen:\n%s",
+				timeout, re.String(), strings.Join(recent, "\n"))
+		}
+	}
+}
+
+// LogFrame pairs a StreamFrame with whether it's the first frame read from
+// a newly encountered source file.
+type LogFrame struct {
+	*StreamFrame
+
+	// FileBoundary is true for the first frame carrying a given File value,
+	// including the very first frame of the stream, so a consumer following
+	// logs across rotation can tell "this data came from stdout.2 starting
+	// here" without tracking File transitions itself.
+	FileBoundary bool
+}
+
+// LogsWithFileBoundary is like Logs, but wraps each frame in a LogFrame
+// flagging FileBoundary whenever the frame's File differs from the
+// previous frame's. Nomad's logs endpoint already rotates transparently
+// across a task's numbered log files and stamps each frame with the File
+// it came from; this just surfaces that transition explicitly instead of
+// requiring every consumer to track File changes itself.
+func (a *AllocFS) LogsWithFileBoundary(alloc *Allocation, follow bool, task, logType, origin string,
+	offset int64, cancel <-chan struct{}, q *QueryOptions) (<-chan *LogFrame, <-chan error) {
+
+	frames, errCh := a.Logs(alloc, follow, task, logType, origin, offset, cancel, q)
+
+	out := make(chan *LogFrame, 10)
+
+	go func() {
+		defer close(out)
+
+		lastFile := ""
+		seenFile := false
+
+		for f := range frames {
+			boundary := f.File != "" && (!seenFile || f.File != lastFile)
+			if f.File != "" {
+				lastFile = f.File
+				seenFile = true
+			}
+
+			select {
+			case out <- &LogFrame{StreamFrame: f, FileBoundary: boundary}:
+			case <-cancel:
+				return
+			}
+		}
+	}()
+
+	return out, errCh
+}
+
+// logFileNameRe matches the filenames Nomad gives log files in an
+// allocation's alloc/logs directory, e.g. "redis.stdout.0".
+var logFileNameRe = regexp.MustCompile(`^(.+)\.(stdout|stderr)\.(\d+)$`)
+
+// unrecognizedLogsTask is the key AllLogs groups log files under when their
+// name doesn't match the expected "<task>.<stdout|stderr>.<index>" pattern.
+const unrecognizedLogsTask = "_unrecognized"
+
+// ParseLogFileName parses name, a filename from an allocation's alloc/logs
+// directory, into the task it belongs to, whether it is stdout or stderr,
+// and its rotation index. ok is false if name doesn't match the expected
+// "<task>.<stdout|stderr>.<index>" pattern.
+func ParseLogFileName(name string) (task, logType string, index int, ok bool) {
+	matches := logFileNameRe.FindStringSubmatch(name)
+	if matches == nil {
+		return "", "", 0, false
+	}
+
+	idx, err := strconv.Atoi(matches[3])
+	if err != nil {
+		return "", "", 0, false
+	}
+
+	return matches[1], matches[2], idx, true
+}
+
+// AllLogs lists alloc's logs directory and groups the files it finds by
+// task, using ParseLogFileName, so a caller can render per-task log tabs
+// without doing its own grouping. Files whose name doesn't match the
+// expected log file pattern are grouped under the unrecognizedLogsTask key
+// rather than dropped.
+func (a *AllocFS) AllLogs(alloc *Allocation, q *QueryOptions) (map[string][]*AllocFileInfo, error) {
+	entries, _, err := a.List(alloc, "alloc/logs", q)
+	if err != nil {
+		return nil, err
+	}
+
+	grouped := make(map[string][]*AllocFileInfo)
+	for _, entry := range entries {
+		if entry.IsDir {
+			continue
+		}
+
+		task, _, _, ok := ParseLogFileName(entry.Name)
+		if !ok {
+			task = unrecognizedLogsTask
+		}
+
+		grouped[task] = append(grouped[task], entry)
+	}
+
+	return grouped, nil
+}
+
+// TasksWithLogs lists alloc's logs directory, via AllLogs, and returns the
+// distinct, sorted set of task names that have written at least one log
+// file -- for building a task selector without needing the job spec to
+// know which tasks actually produced output. Filenames that don't match
+// the expected "<task>.<stdout|stderr>.<index>" pattern are skipped rather
+// than reported as a task, since ParseLogFileName can't recover a task
+// name from them.
+func (a *AllocFS) TasksWithLogs(alloc *Allocation, q *QueryOptions) ([]string, error) {
+	grouped, err := a.AllLogs(alloc, q)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]string, 0, len(grouped))
+	for task := range grouped {
+		if task == unrecognizedLogsTask {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	sort.Strings(tasks)
+
+	return tasks, nil
+}
+
+// openLogTailThreshold is the combined size, across all of a task's rotated
+// log files for a given logType, above which OpenLog starts at the tail
+// instead of the beginning. This mirrors what typical log viewers default
+// to: don't make the caller wait to open a log that's already huge.
+const openLogTailThreshold = 1 << 20 // 1MiB
+
+// OpenLog opens task's logType log the way a typical log viewer would: if
+// the combined size of its rotated log files (per AllLogs) exceeds
+// openLogTailThreshold, it starts approximately tailLines lines from the
+// end -- using tailBytesPerLineEstimate the same best-effort way TailAll
+// does, since the node has no line-count API -- and follows from there;
+// otherwise, or if tailLines is not positive, it reads from the very
+// beginning and follows. Either way the returned channels behave exactly
+// like Logs's with follow=true: they never close on their own, and closing
+// cancel is how a caller tears the stream down.
+func (a *AllocFS) OpenLog(alloc *Allocation, task, logType string, tailLines int,
+	cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+
+	grouped, err := a.AllLogs(alloc, q)
+	if err != nil {
+		errCh := make(chan error, 1)
+		errCh <- err
+		return nil, errCh
+	}
+
+	var total int64
+	for _, entry := range grouped[task] {
+		_, lt, _, ok := ParseLogFileName(entry.Name)
+		if ok && lt == logType {
+			total += entry.Size
+		}
+	}
+
+	origin := OriginStart
+	var offset int64
+	if total > openLogTailThreshold && tailLines > 0 {
+		origin = OriginEnd
+		offset = int64(tailLines) * tailBytesPerLineEstimate
+	}
+
+	return a.Logs(alloc, true, task, logType, origin, offset, cancel, q)
+}
+
+// LogOffset identifies a position within a logical rotated log as the
+// file it falls in and the byte offset within that file.
+type LogOffset struct {
+	File   string
+	Offset int64
+}
+
+// ResolveLogOffset maps globalOffset, a byte position in the logical
+// concatenation of entries in rotation order (lowest ParseLogFileName
+// index first, which is the oldest file), to the file and intra-file
+// offset it falls in. entries is typically one task's stdout or stderr
+// files as returned by AllLogs; it may be given in any order, since
+// ResolveLogOffset sorts a copy by rotation index itself. This lets a log
+// shipper checkpoint against a single global offset that stays stable
+// across rotations, instead of a per-file offset that rotation
+// invalidates. An error is returned if globalOffset is negative or falls
+// at or past the end of the combined logs.
+func ResolveLogOffset(entries []*AllocFileInfo, globalOffset int64) (LogOffset, error) {
+	if globalOffset < 0 {
+		return LogOffset{}, fmt.Errorf("globalOffset must be >= 0, got %d", globalOffset)
+	}
+
+	sorted := make([]*AllocFileInfo, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool {
+		_, _, idxI, _ := ParseLogFileName(sorted[i].Name)
+		_, _, idxJ, _ := ParseLogFileName(sorted[j].Name)
+		return idxI < idxJ
+	})
+
+	var total int64
+	remaining := globalOffset
+	for _, e := range sorted {
+		total += e.Size
+		if remaining < e.Size {
+			return LogOffset{File: e.Name, Offset: remaining}, nil
+		}
+		remaining -= e.Size
+	}
+
+	return LogOffset{}, fmt.Errorf("offset %d is past the end of %d combined log bytes", globalOffset, total)
+}
+
+// CombinedLogs streams both the stdout and stderr logs of a task and merges
+// them into a single io.ReadCloser, similar to `docker logs`. When
+// prefixStderr is true, each line written from the stderr stream is prefixed
+// with "stderr: " so a reader can still tell the streams apart. Merge
+// ordering is best-effort: frames are written in the order they arrive from
+// the two independent underlying streams, not by the time they were
+// produced on the client.
+// The returned reader is an *FSReader, so callers that want to copy it
+// directly to a destination can use its WriteTo method.
+// CombinedLogs' merge goroutine derives its own done channel and merges it
+// with the caller's cancel so that closing the returned reader - the
+// natural way to stop consuming it - is by itself enough to tear down both
+// underlying a.Logs() streams, without also requiring the caller to close
+// cancel separately.
+func (a *AllocFS) CombinedLogs(alloc *Allocation, task string, prefixStderr, follow bool,
+	cancel <-chan struct{}, q *QueryOptions) (io.ReadCloser, error) {
+
+	done := make(chan struct{})
+	merged := mergeCancel(cancel, done)
+
+	outFrames, outErrs := a.Logs(alloc, follow, task, "stdout", OriginStart, 0, merged, q)
+	errFrames, errErrs := a.Logs(alloc, follow, task, "stderr", OriginStart, 0, merged, q)
+
+	r, w := io.Pipe()
+
+	go func() {
+		defer w.Close()
+		defer close(done)
+
+		for outFrames != nil || errFrames != nil {
+			select {
+			case f, ok := <-outFrames:
+				if !ok {
+					outFrames = nil
+					continue
+				}
+				if _, err := w.Write(f.Data); err != nil {
+					return
+				}
+			case f, ok := <-errFrames:
+				if !ok {
+					errFrames = nil
+					continue
+				}
+				if prefixStderr {
+					if err := writePrefixedLines(w, "stderr: ", f.Data); err != nil {
+						return
+					}
+				} else {
+					if _, err := w.Write(f.Data); err != nil {
+						return
+					}
+				}
+			case err := <-outErrs:
+				w.CloseWithError(err)
+				return
+			case err := <-errErrs:
+				w.CloseWithError(err)
+				return
+			case <-cancel:
+				return
+			}
+		}
+	}()
+
+	return &FSReader{ReadCloser: r}, nil
+}
+
+// writePrefixedLines writes data to w, prefixing every line it contains with
+// prefix. It is used to visually separate stderr output in CombinedLogs. It
+// returns the first error encountered so callers writing to a pipe can
+// detect the reader side going away.
+func writePrefixedLines(w io.Writer, prefix string, data []byte) error {
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if _, err := io.WriteString(w, prefix); err != nil {
+			return err
+		}
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FrameReader is used to convert a stream of frames into a read closer.
+type FrameReader struct {
+	frames   <-chan *StreamFrame
+	errCh    <-chan error
+	cancelCh chan struct{}
+
+	closedLock sync.Mutex
+	closed     bool
+
+	unblockTime time.Duration
+
+	frame       *StreamFrame
+	frameOffset int
+
+	byteOffset int
+}
+
+// NewFrameReader takes a channel of frames and returns a FrameReader which
+// implements io.ReadCloser
+func NewFrameReader(frames <-chan *StreamFrame, errCh <-chan error, cancelCh chan struct{}) *FrameReader {
+	return &FrameReader{
+		frames:   frames,
+		errCh:    errCh,
+		cancelCh: cancelCh,
+	}
+}
+
+// SetUnblockTime sets the time to unblock and return zero bytes read. If the
+// duration is unset or is zero or less, the read will block until data is read.
+func (f *FrameReader) SetUnblockTime(d time.Duration) {
+	f.unblockTime = d
+}
+
+// Offset returns the offset into the stream.
+func (f *FrameReader) Offset() int {
+	return f.byteOffset
+}
+
+// Read reads the data of the incoming frames into the bytes buffer. Returns EOF
+// when there are no more frames.
+func (f *FrameReader) Read(p []byte) (n int, err error) {
+	f.closedLock.Lock()
+	closed := f.closed
+	f.closedLock.Unlock()
+	if closed {
+		return 0, io.EOF
+	}
+
+	if f.frame == nil {
+		var unblock <-chan time.Time
+		if f.unblockTime.Nanoseconds() > 0 {
+			unblock = time.After(f.unblockTime)
+		}
+
+		select {
+		case frame, ok := <-f.frames:
+			if !ok {
+				return 0, io.EOF
+			}
+			f.frame = frame
+
+			// Store the total offset into the file
+			f.byteOffset = int(f.frame.Offset)
+		case <-unblock:
+			return 0, nil
+		case err := <-f.errCh:
+			return 0, err
+		case <-f.cancelCh:
+			return 0, io.EOF
+		}
+	}
+
+	// Copy the data out of the frame and update our offset
+	n = copy(p, f.frame.Data[f.frameOffset:])
+	f.frameOffset += n
+
+	// Clear the frame and its offset once we have read everything
+	if len(f.frame.Data) == f.frameOffset {
+		f.frame = nil
+		f.frameOffset = 0
+	}
+
+	return n, nil
+}
+
+// Close cancels the stream of frames
+func (f *FrameReader) Close() error {
+	f.closedLock.Lock()
+	defer f.closedLock.Unlock()
+	if f.closed {
+		return nil
+	}
+
+	close(f.cancelCh)
+	f.closed = true
+	return nil
+}
+
+// StreamDecode streams the file at path, using a FrameReader to reassemble
+// StreamFrame.Data across frame boundaries into lines, and invokes parse on
+// every complete line, sending its result on the returned channel. This
+// lets a caller decode a custom line-oriented frame format (e.g.
+// newline-delimited JSON) without reimplementing FrameReader's
+// reassembly. A parse error stops the stream and is sent on the returned
+// error channel.
+//
+// This module is kept compatible with Go 1.12, so unlike a generic
+// StreamDecode[T any], parse returns interface{} and callers type-assert
+// the values they receive.
+func (a *AllocFS) StreamDecode(alloc *Allocation, path, origin string, offset int64,
+	parse func(line []byte) (interface{}, error), cancel <-chan struct{}, q *QueryOptions) (<-chan interface{}, <-chan error) {
+
+	frames, frameErrs := a.Stream(alloc, path, origin, offset, cancel, q)
+
+	out := make(chan interface{}, 10)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+
+		fr := NewFrameReader(frames, frameErrs, make(chan struct{}))
+		defer fr.Close()
+
+		scanner := bufio.NewScanner(fr)
+		for scanner.Scan() {
+			select {
+			case <-cancel:
+				return
+			default:
+			}
+
+			val, err := parse(scanner.Bytes())
+			if err != nil {
+				errCh <- err
+				return
+			}
+			out <- val
+		}
+		if err := scanner.Err(); err != nil {
+			errCh <- err
+		}
+	}()
+
+	return out, errCh
+}
+
+// TaskExitResult describes how a task terminated, including the exit code
+// and, if the task was killed by a signal, the signal number.
+type TaskExitResult struct {
+	ExitCode int
+	Signal   int
+	Event    *TaskEvent
+}
+
+// Err returns nil for a clean, zero-exit-code termination, and otherwise a
+// descriptive error identifying the non-zero exit code or the signal the
+// task was killed by, so callers can fold WaitForTaskExit's result into
+// ordinary `if err := ...; err != nil` control flow instead of inspecting
+// ExitCode and Signal themselves.
+func (r *TaskExitResult) Err() error {
+	if r.Signal != 0 {
+		return fmt.Errorf("task killed by signal %d", r.Signal)
+	}
+	if r.ExitCode != 0 {
+		return fmt.Errorf("task exited with code %d", r.ExitCode)
+	}
+	return nil
+}
+
+// WaitForTaskExit polls the allocation until the named task has a terminal
+// TaskTerminated event or ctx is done, and returns the exit details found in
+// that event. It returns ctx.Err() if the deadline or cancellation occurs
+// before the task terminates.
+func (a *AllocFS) WaitForTaskExit(ctx context.Context, alloc *Allocation, task string, interval time.Duration) (*TaskExitResult, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	for {
+		cur, _, err := a.client.Allocations().Info(alloc.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if state, ok := cur.TaskStates[task]; ok {
+			for i := len(state.Events) - 1; i >= 0; i-- {
+				event := state.Events[i]
+				if event.Type == TaskTerminated {
+					return &TaskExitResult{
+						ExitCode: event.ExitCode,
+						Signal:   event.Signal,
+						Event:    event,
+					}, nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// TaskExitResultWithLogTail bundles WaitForTaskExit's result with the last
+// lines of the task's stdout log, fetched immediately afterward.
+type TaskExitResultWithLogTail struct {
+	*TaskExitResult
+
+	// LogTail holds the task's last tailLines lines of stdout output. It
+	// is nil if LogsUnavailable is true.
+	LogTail []string
+
+	// LogsUnavailable is set instead of failing the call when the task's
+	// logs were already garbage collected by the time the tail was
+	// fetched. ExitCode, Signal, and Event remain valid in that case.
+	LogsUnavailable bool
+}
+
+// latestLogFile returns the alloc/logs path of the highest-index (most
+// recent) logType log file for task, per ParseLogFileName's rotation
+// index.
+func (a *AllocFS) latestLogFile(alloc *Allocation, task, logType string, q *QueryOptions) (string, error) {
+	grouped, err := a.AllLogs(alloc, q)
+	if err != nil {
+		return "", err
+	}
+
+	var best string
+	bestIdx := -1
+	for _, entry := range grouped[task] {
+		_, lt, idx, ok := ParseLogFileName(entry.Name)
+		if !ok || lt != logType || idx < bestIdx {
+			continue
+		}
+		bestIdx = idx
+		best = entry.Name
+	}
+	if best == "" {
+		return "", fmt.Errorf("no %s log found for task %q", logType, task)
+	}
+
+	return gopath.Join("alloc/logs", best), nil
+}
+
+// WaitForTaskExitWithLogTail waits for task to terminate the same way
+// WaitForTaskExit does, then immediately fetches the last tailLines lines
+// of its stdout log. Doing both in one call closes the race where a
+// task's retained logs are garbage collected shortly after it exits: a
+// caller that separately waits and then reads can lose the logs in
+// between, where this helper instead reports LogsUnavailable and still
+// returns the exit result, which is the half of the answer post-mortem
+// tooling can still use.
+func (a *AllocFS) WaitForTaskExitWithLogTail(ctx context.Context, alloc *Allocation, task string, tailLines int, interval time.Duration) (*TaskExitResultWithLogTail, error) {
+	result, err := a.WaitForTaskExit(ctx, alloc, task, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	logPath, err := a.latestLogFile(alloc, task, "stdout", nil)
+	if err != nil {
+		return &TaskExitResultWithLogTail{TaskExitResult: result, LogsUnavailable: true}, nil
+	}
+
+	_, tail, err := a.HeadTail(alloc, logPath, 0, tailLines, nil)
+	if err != nil {
+		if errors.Is(err, ErrAllocationGCd) || isNotFoundError(err) {
+			return &TaskExitResultWithLogTail{TaskExitResult: result, LogsUnavailable: true}, nil
+		}
+		return nil, err
+	}
+
+	return &TaskExitResultWithLogTail{TaskExitResult: result, LogTail: tail}, nil
+}
+
+// CheckResult reports the outcome of a pre-flight reachability check for an
+// allocation's filesystem, as performed by AllocFS.Check.
+type CheckResult struct {
+	// NodeAddressResolved is true if the allocation's node was found and
+	// advertises a reachable HTTP address.
+	NodeAddressResolved bool
+
+	// AuthOK is true if a request against the node (or, failing that, the
+	// server) was accepted rather than rejected for authorization reasons.
+	AuthOK bool
+
+	// PathExists is true if the given path was found on the allocation.
+	PathExists bool
+}
+
+// Check performs a cheap pre-flight check of whether path is reachable on
+// alloc: whether the node's HTTP address resolved, whether the request was
+// authorized, and whether the path exists. Results are returned in a single
+// CheckResult rather than as a sequence of independent errors, along with
+// the error (if any) encountered along the way.
+func (a *AllocFS) Check(alloc *Allocation, path string, q *QueryOptions) (*CheckResult, error) {
+	result := &CheckResult{}
+
+	if _, err := a.client.GetNodeClientWithTimeout(alloc.NodeID, ClientConnTimeout, q); err == nil {
+		result.NodeAddressResolved = true
+	}
+
+	_, _, err := a.Stat(alloc, path, q)
+	if err == nil {
+		result.AuthOK = true
+		result.PathExists = true
+		return result, nil
+	}
+
+	if errors.Is(err, ErrPermissionDenied) {
+		return result, err
+	}
+
+	result.AuthOK = true
+	if isNotFoundError(err) {
+		return result, err
+	}
+
+	return result, err
+}
+
+// CatChecked is like Cat, but first calls Check to verify path is
+// reachable and the request is authorized, returning that clear, early
+// error instead of letting the caller discover an authorization failure
+// only after a large read has already started. This costs an extra round
+// trip, so it's opt-in for callers about to start an expensive or
+// long-running Cat rather than the default.
+func (a *AllocFS) CatChecked(alloc *Allocation, path string, q *QueryOptions) (io.ReadCloser, error) {
+	if _, err := a.Check(alloc, path, q); err != nil {
+		return nil, err
+	}
+	return a.Cat(alloc, path, q)
+}
+
+// CatCompressed is like Cat, but returns the content gzip-compressed
+// rather than raw, for callers about to write it straight to a .gz
+// archive. The underlying HTTP client already transparently decompresses
+// any gzip-encoded response before Cat ever sees it (see doRequest), so
+// there's no way to hand back a node's own compressed bytes untouched:
+// CatCompressed always falls back to compressing the content client-side.
+// Callers still save having to wire up their own gzip.Writer.
+func (a *AllocFS) CatCompressed(alloc *Allocation, path string, q *QueryOptions) (io.ReadCloser, error) {
+	r, err := a.Cat(alloc, path, q)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		defer r.Close()
+
+		gz := gzip.NewWriter(pw)
+		if _, err := io.Copy(gz, r); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if err := gz.Close(); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.Close()
+	}()
+
+	return pr, nil
+}
+
+// TailBytes returns the last n bytes of the file at path, via a Stat
+// followed by a single ReadAt computed from the resulting size. If the
+// file is smaller than n, the entire file is returned. Unlike LastLine,
+// TailBytes makes no assumption that the content is newline-delimited
+// text, which makes it suitable for crash triage on binary-ish logs
+// where "the tail of the file as of now" is wanted without reading the
+// whole thing into memory via Cat.
+func (a *AllocFS) TailBytes(alloc *Allocation, path string, n int64, q *QueryOptions) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("n must be >= 0, got %d", n)
+	}
+
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size == 0 || n == 0 {
+		return []byte{}, nil
+	}
+
+	window := n
+	if window > info.Size {
+		window = info.Size
+	}
+	offset := info.Size - window
+
+	r, err := a.ReadAt(alloc, path, offset, window, q)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// lastLineInitialWindow is the size of the first backward read LastLine
+// performs from the end of the file.
+const lastLineInitialWindow = 4 * 1024
+
+// lastLineMaxWindow bounds how far LastLine will read backward looking for
+// a newline, so a file with a pathologically long final line doesn't cause
+// an unbounded read.
+const lastLineMaxWindow = 1 << 20 // 1MiB
+
+// LastLine returns the final complete line of the file at path, reading
+// backward from the end in small windows via ReadAt rather than Stat-ing
+// and scanning the whole file. This is efficient for huge files where only
+// the last record is needed. The backward window doubles until a newline is
+// found, the start of the file is reached, or lastLineMaxWindow is hit, in
+// which case an error is returned rather than reading the whole file.
+func (a *AllocFS) LastLine(alloc *Allocation, path string, q *QueryOptions) (string, error) {
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return "", err
+	}
+	if info.Size == 0 {
+		return "", nil
+	}
+
+	window := int64(lastLineInitialWindow)
+
+	for {
+		capped := window >= lastLineMaxWindow
+		if capped {
+			window = lastLineMaxWindow
+		}
+		if window > info.Size {
+			window = info.Size
+		}
+
+		offset := info.Size - window
+		r, err := a.ReadAt(alloc, path, offset, window, q)
+		if err != nil {
+			return "", err
+		}
+		buf, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return "", err
+		}
+
+		trimmed := bytes.TrimSuffix(buf, []byte("\n"))
+
+		if idx := bytes.LastIndexByte(trimmed, '\n'); idx != -1 {
+			return string(trimmed[idx+1:]), nil
+		}
+
+		if offset == 0 {
+			return string(trimmed), nil
+		}
+
+		if capped {
+			return "", fmt.Errorf("no newline found within the last %d bytes of %q", lastLineMaxWindow, path)
+		}
+
+		window *= 2
+	}
+}
+
+// splitCompleteLines splits buf on newlines into complete lines. If buf
+// doesn't end with a newline and atEOF is false, the trailing fragment is
+// a partial line cut off by the read window rather than a real boundary,
+// so it's dropped; if atEOF is true, it's kept as the file's final line.
+func splitCompleteLines(buf []byte, atEOF bool) []string {
+	hadTrailingNewline := len(buf) > 0 && buf[len(buf)-1] == '\n'
+	trimmed := buf
+	if hadTrailingNewline {
+		trimmed = buf[:len(buf)-1]
+	}
+	if len(trimmed) == 0 {
+		return nil
+	}
+
+	lines := strings.Split(string(trimmed), "\n")
+	if !hadTrailingNewline && !atEOF {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// headLinesWindow reads a growing window from the start of the file at
+// path until it has headLines complete lines, the whole file has been
+// read, or lastLineMaxWindow is hit.
+func (a *AllocFS) headLinesWindow(alloc *Allocation, path string, size int64, headLines int, q *QueryOptions) ([]string, error) {
+	window := int64(lastLineInitialWindow)
+
+	for {
+		capped := window >= lastLineMaxWindow
+		if capped {
+			window = lastLineMaxWindow
+		}
+		if window > size {
+			window = size
+		}
+
+		r, err := a.ReadAt(alloc, path, 0, window, q)
+		if err != nil {
+			return nil, err
+		}
+		buf, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		lines := splitCompleteLines(buf, window == size)
+		if len(lines) >= headLines || window == size || capped {
+			if len(lines) > headLines {
+				lines = lines[:headLines]
+			}
+			return lines, nil
+		}
+
+		window *= 2
+	}
+}
+
+// tailLinesWindow reads a growing window from the end of the file at path
+// until it has tailLines complete lines, the whole file has been read, or
+// lastLineMaxWindow is hit.
+func (a *AllocFS) tailLinesWindow(alloc *Allocation, path string, size int64, tailLines int, q *QueryOptions) ([]string, error) {
+	window := int64(lastLineInitialWindow)
+
+	for {
+		capped := window >= lastLineMaxWindow
+		if capped {
+			window = lastLineMaxWindow
+		}
+		if window > size {
+			window = size
+		}
+		offset := size - window
+
+		r, err := a.ReadAt(alloc, path, offset, window, q)
+		if err != nil {
+			return nil, err
+		}
+		buf, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		lines := splitCompleteLines(buf, true)
+		if offset > 0 && len(lines) > 0 {
+			// The first line of a non-start window may be a partial line
+			// continued from before offset.
+			lines = lines[1:]
+		}
+
+		if len(lines) >= tailLines || offset == 0 || capped {
+			if len(lines) > tailLines {
+				lines = lines[len(lines)-tailLines:]
+			}
+			return lines, nil
+		}
+
+		window *= 2
+	}
+}
+
+// headTailWholeFileThreshold is the file size below which HeadTail reads
+// the whole file in one request rather than windowing from each end,
+// since below this size the head and tail windows could otherwise
+// overlap.
+const headTailWholeFileThreshold = 2 * lastLineMaxWindow
+
+// HeadTail returns the first headLines and last tailLines lines of the
+// file at path without downloading the whole file for large files, via
+// ReadAt windows grown from each end the same way LastLine does. If the
+// file is small enough that the head and tail windows could overlap, the
+// whole file is read once and split instead, so no line is duplicated
+// between head and tail.
+func (a *AllocFS) HeadTail(alloc *Allocation, path string, headLines, tailLines int, q *QueryOptions) (head, tail []string, err error) {
+	if headLines < 0 || tailLines < 0 {
+		return nil, nil, fmt.Errorf("headLines and tailLines must be >= 0")
+	}
+
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Size == 0 {
+		return nil, nil, nil
+	}
+
+	if info.Size <= headTailWholeFileThreshold {
+		r, err := a.ReadAt(alloc, path, 0, info.Size, q)
+		if err != nil {
+			return nil, nil, err
+		}
+		buf, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		lines := splitCompleteLines(buf, true)
+		n := len(lines)
+		if headLines > n {
+			headLines = n
+		}
+		if tailLines > n-headLines {
+			tailLines = n - headLines
+		}
+		return lines[:headLines], lines[n-tailLines:], nil
+	}
+
+	if headLines > 0 {
+		head, err = a.headLinesWindow(alloc, path, info.Size, headLines, q)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if tailLines > 0 {
+		tail, err = a.tailLinesWindow(alloc, path, info.Size, tailLines, q)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return head, tail, nil
+}
+
+// ParallelCat reads the file at path in parts concurrent ranged ReadAt
+// requests and presents the reassembled bytes, in order, through a single
+// reader. For very large files over a fast pipe, fetching ranges in
+// parallel can beat a single streamed Cat. If any part fails, the first
+// error encountered is returned and no reader is produced.
+func (a *AllocFS) ParallelCat(alloc *Allocation, path string, parts int, q *QueryOptions) (io.ReadCloser, error) {
+	if parts <= 0 {
+		return nil, fmt.Errorf("parts must be positive")
+	}
+
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	if int64(parts) > info.Size {
+		parts = int(info.Size)
+	}
+
+	partSize := info.Size / int64(parts)
+	if info.Size%int64(parts) != 0 {
+		partSize++
+	}
+
+	buffers := make([][]byte, parts)
+	errs := make([]error, parts)
+
+	var wg sync.WaitGroup
+	for i := 0; i < parts; i++ {
+		offset := int64(i) * partSize
+		limit := partSize
+		if remaining := info.Size - offset; remaining < limit {
+			limit = remaining
+		}
+		if limit <= 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, offset, limit int64) {
+			defer wg.Done()
+
+			r, err := a.ReadAt(alloc, path, offset, limit, q)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer r.Close()
+
+			buf, err := io.ReadAll(r)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			buffers[i] = buf
+		}(i, offset, limit)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	readers := make([]io.Reader, 0, len(buffers))
+	for _, buf := range buffers {
+		readers = append(readers, bytes.NewReader(buf))
+	}
+
+	return io.NopCloser(io.MultiReader(readers...)), nil
+}
+
+// CountLines counts the newlines in the file at path, matching `wc -l`
+// semantics: a trailing partial line with no terminating newline is not
+// counted. The file is streamed through a small fixed-size buffer rather
+// than read into memory, so this is safe to use on files too large to
+// download to the client.
+func (a *AllocFS) CountLines(alloc *Allocation, path string, q *QueryOptions) (int64, error) {
+	r, err := a.Cat(alloc, path, q)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	return countNewlines(r)
+}
+
+// ParallelCountLines is like CountLines, but fetches the file in parts
+// concurrent ranged ReadAt requests, the same strategy ParallelCat uses,
+// which can beat a single streamed Cat for very large files over a fast
+// pipe. Each part is counted independently and the totals summed, which
+// gives the same result as counting the whole file in one pass since a
+// newline can't straddle a part boundary without being counted in
+// whichever part it actually falls in.
+func (a *AllocFS) ParallelCountLines(alloc *Allocation, path string, parts int, q *QueryOptions) (int64, error) {
+	if parts <= 0 {
+		return 0, fmt.Errorf("parts must be positive")
+	}
+
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return 0, err
+	}
+
+	if info.Size == 0 {
+		return 0, nil
+	}
+
+	if int64(parts) > info.Size {
+		parts = int(info.Size)
+	}
+
+	partSize := info.Size / int64(parts)
+	if info.Size%int64(parts) != 0 {
+		partSize++
+	}
+
+	counts := make([]int64, parts)
+	errs := make([]error, parts)
+
+	var wg sync.WaitGroup
+	for i := 0; i < parts; i++ {
+		offset := int64(i) * partSize
+		limit := partSize
+		if remaining := info.Size - offset; remaining < limit {
+			limit = remaining
+		}
+		if limit <= 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, offset, limit int64) {
+			defer wg.Done()
+
+			r, err := a.ReadAt(alloc, path, offset, limit, q)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer r.Close()
+
+			n, err := countNewlines(r)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			counts[i] = n
+		}(i, offset, limit)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total, nil
+}
+
+// countNewlines counts the '\n' bytes in r using a small fixed-size buffer,
+// never holding more than the buffer's worth of r's contents in memory.
+func countNewlines(r io.Reader) (int64, error) {
+	buf := make([]byte, 32*1024)
+
+	var count int64
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if b == '\n' {
+				count++
+			}
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// ErrDownloadBudgetExceeded is returned by DownloadTree when downloading a
+// file would exceed the configured byte budget.
+type ErrDownloadBudgetExceeded struct {
+	Path   string
+	Budget int64
+}
+
+func (e *ErrDownloadBudgetExceeded) Error() string {
+	return fmt.Sprintf("download budget of %d bytes exceeded at %q", e.Budget, e.Path)
+}
+
+// DownloadTree recursively walks the directory at path and invokes visit
+// with the path (relative to the allocation's root) and contents of every
+// regular file found beneath it. If maxTotalBytes is positive, the tree's
+// total size is pre-summed via List/Stat before any download begins, and
+// DownloadTree fails fast with an *ErrDownloadBudgetExceeded if that sum
+// exceeds the budget; it also aborts mid-tree, identifying the offending
+// file the same way, if the cumulative bytes downloaded would exceed the
+// budget. This protects operators from accidentally pulling down a huge
+// allocation directory.
+func (a *AllocFS) DownloadTree(alloc *Allocation, path string, maxTotalBytes int64,
+	visit func(path string, r io.Reader) error, q *QueryOptions) error {
+
+	if maxTotalBytes > 0 {
+		total, err := a.treeSize(alloc, path, q)
+		if err != nil {
+			return err
+		}
+		if total > maxTotalBytes {
+			return &ErrDownloadBudgetExceeded{Path: path, Budget: maxTotalBytes}
+		}
+	}
+
+	var downloaded int64
+	return a.downloadTree(alloc, path, maxTotalBytes, &downloaded, visit, q)
+}
+
+// treeSize sums the size of every regular file under path.
+func (a *AllocFS) treeSize(alloc *Allocation, path string, q *QueryOptions) (int64, error) {
+	entries, _, err := a.List(alloc, path, q)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir {
+			sub, err := a.treeSize(alloc, gopath.Join(path, entry.Name), q)
+			if err != nil {
+				return 0, err
+			}
+			total += sub
+			continue
+		}
+		total += entry.Size
+	}
+
+	return total, nil
+}
+
+// downloadTree is the recursive worker behind DownloadTree. downloaded
+// tracks the cumulative bytes downloaded so far across the whole walk.
+func (a *AllocFS) downloadTree(alloc *Allocation, path string, maxTotalBytes int64, downloaded *int64,
+	visit func(path string, r io.Reader) error, q *QueryOptions) error {
+
+	entries, _, err := a.List(alloc, path, q)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryPath := gopath.Join(path, entry.Name)
+
+		if entry.IsDir {
+			if err := a.downloadTree(alloc, entryPath, maxTotalBytes, downloaded, visit, q); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if maxTotalBytes > 0 && *downloaded+entry.Size > maxTotalBytes {
+			return &ErrDownloadBudgetExceeded{Path: entryPath, Budget: maxTotalBytes}
+		}
+
+		r, err := a.Cat(alloc, entryPath, q)
+		if err != nil {
+			return err
+		}
+		err = visit(entryPath, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+
+		*downloaded += entry.Size
+	}
+
+	return nil
+}
+
+// ManifestEntry describes one file found by Manifest: a snapshot of its
+// path, size, mode, mtime, and content hash, sufficient for a caller to
+// verify or compare a remote allocation directory without retaining its
+// contents.
+type ManifestEntry struct {
+	Path    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	SHA256  string
+}
+
+// manifestMaxConcurrency bounds how many files Manifest hashes at once, so
+// manifesting a directory with many files doesn't open that many
+// simultaneous Cat connections to the node at a time.
+const manifestMaxConcurrency = 8
+
+// Manifest walks the directory tree rooted at root and returns a
+// ManifestEntry -- path, size, mode, mtime, and SHA256 -- for every regular
+// file found beneath it. Each file's hash is computed via Hash, which
+// streams it through Cat rather than buffering it, so this is safe to use
+// against directories too large to download in full; up to
+// manifestMaxConcurrency files are hashed at once. The result is a
+// verifiable, comparable snapshot description of an allocation directory,
+// suited to reproducibility and audit use cases that don't need the file
+// contents themselves.
+//
+// A file that fails to hash doesn't abort the whole walk: Manifest keeps
+// hashing every other file and returns their entries alongside the
+// failures, joined together with errors.Join, the same partial-results
+// convention ListRecursive uses. The initial tree listing is the
+// exception -- if that fails there's nothing to return partial results
+// for.
+func (a *AllocFS) Manifest(alloc *Allocation, root string, q *QueryOptions) ([]ManifestEntry, error) {
+	var files []*AllocFileInfo
+	var paths []string
+	if err := a.collectManifestFiles(alloc, root, &files, &paths, q); err != nil {
+		return nil, err
+	}
+
+	entries := make([]ManifestEntry, len(files))
+	errs := make([]error, len(files))
+
+	sem := make(chan struct{}, manifestMaxConcurrency)
+	var wg sync.WaitGroup
+	for i := range files {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			entries[i], errs[i] = a.manifestEntry(alloc, paths[i], files[i], q)
+		}(i)
+	}
+	wg.Wait()
+
+	return entries, errors.Join(errs...)
+}
+
+// collectManifestFiles recursively lists path, appending every regular
+// file found beneath it, and its full alloc-relative path, to files and
+// paths.
+func (a *AllocFS) collectManifestFiles(alloc *Allocation, path string, files *[]*AllocFileInfo, paths *[]string, q *QueryOptions) error {
+	entries, _, err := a.List(alloc, path, q)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryPath := gopath.Join(path, entry.Name)
+		if entry.IsDir {
+			if err := a.collectManifestFiles(alloc, entryPath, files, paths, q); err != nil {
+				return err
 			}
+			continue
+		}
+		*files = append(*files, entry)
+		*paths = append(*paths, entryPath)
+	}
 
-			// Decode the next frame
-			var frame StreamFrame
-			if err := dec.Decode(&frame); err != nil {
-				if err == io.EOF || err == io.ErrClosedPipe {
-					close(frames)
-				} else {
-					errCh <- err
+	return nil
+}
+
+// manifestEntry hashes a single file for Manifest.
+func (a *AllocFS) manifestEntry(alloc *Allocation, path string, info *AllocFileInfo, q *QueryOptions) (ManifestEntry, error) {
+	sum, err := a.Hash(alloc, path, sha256.New(), q)
+	if err != nil {
+		return ManifestEntry{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	mode, err := info.FileModeBits()
+	if err != nil {
+		mode = 0644
+	}
+
+	return ManifestEntry{
+		Path:    path,
+		Size:    info.Size,
+		Mode:    mode,
+		ModTime: info.ModTime,
+		SHA256:  hex.EncodeToString(sum),
+	}, nil
+}
+
+// Snapshot tars the entire allocation directory and returns a stream of the
+// archive. Directory modes and file modes/mtimes are preserved in the tar
+// headers so SnapshotExtract can restore them on extraction.
+func (a *AllocFS) Snapshot(alloc *Allocation, q *QueryOptions) (io.ReadCloser, error) {
+	r, w := io.Pipe()
+
+	go func() {
+		tw := tar.NewWriter(w)
+		if err := a.writeTarTree(tw, alloc, "/", q); err != nil {
+			w.CloseWithError(err)
+			return
+		}
+		w.CloseWithError(tw.Close())
+	}()
+
+	return &FSReader{ReadCloser: r}, nil
+}
+
+// writeTarTree recursively walks path and writes a tar header (and, for
+// regular files, their contents) for every entry found beneath it.
+func (a *AllocFS) writeTarTree(tw *tar.Writer, alloc *Allocation, path string, q *QueryOptions) error {
+	entries, _, err := a.List(alloc, path, q)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryPath := gopath.Join(path, entry.Name)
+		name := strings.TrimPrefix(entryPath, "/")
+
+		mode, err := entry.FileModeBits()
+		if err != nil {
+			mode = 0644
+		}
+
+		if entry.IsDir {
+			hdr := &tar.Header{
+				Name:     name + "/",
+				Typeflag: tar.TypeDir,
+				Mode:     int64(mode.Perm()),
+				ModTime:  entry.ModTime,
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if err := a.writeTarTree(tw, alloc, entryPath, q); err != nil {
+				return err
+			}
+			continue
+		}
+
+		r, err := a.Cat(alloc, entryPath, q)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+
+		hdr := &tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Size:     int64(len(data)),
+			Mode:     int64(mode.Perm()),
+			ModTime:  entry.ModTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SnapshotExtractSummary reports the files written by a successful
+// SnapshotExtract call.
+type SnapshotExtractSummary struct {
+	Files      []string
+	TotalBytes int64
+}
+
+// SnapshotExtract streams a Snapshot of alloc's directory and extracts it
+// into destDir, preserving file modes and modification times. Every tar
+// entry's target path is sanitized to ensure it resolves inside destDir,
+// so a malicious or corrupt archive containing a path such as "../../etc"
+// (tar-slip) cannot write outside of it.
+func (a *AllocFS) SnapshotExtract(alloc *Allocation, destDir string, q *QueryOptions) (*SnapshotExtractSummary, error) {
+	r, err := a.Snapshot(alloc, q)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return extractTar(r, destDir)
+}
+
+// extractTar reads the tar archive in r and extracts it into destDir. It is
+// split out from SnapshotExtract so it can be exercised directly against a
+// hand-crafted archive in tests.
+func extractTar(r io.Reader, destDir string) (*SnapshotExtractSummary, error) {
+	summary := &SnapshotExtractSummary{}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return summary, err
+		}
+
+		target, err := sanitizeTarPath(destDir, hdr.Name)
+		if err != nil {
+			return summary, err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(hdr.Mode)|0700); err != nil {
+				return summary, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return summary, err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode))
+			if err != nil {
+				return summary, err
+			}
+			n, err := io.Copy(f, tr)
+			closeErr := f.Close()
+			if err != nil {
+				return summary, err
+			}
+			if closeErr != nil {
+				return summary, closeErr
+			}
+			if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+				return summary, err
+			}
+			summary.Files = append(summary.Files, hdr.Name)
+			summary.TotalBytes += n
+		default:
+			// Skip symlinks and other special entry types; the allocation
+			// filesystem API does not expose them.
+		}
+	}
+
+	return summary, nil
+}
+
+// sanitizeTarPath joins name onto destDir and rejects the result if it
+// escapes destDir, guarding against tar-slip archives containing entries
+// like "../../etc/passwd".
+func sanitizeTarPath(destDir, name string) (string, error) {
+	target := filepath.Join(destDir, filepath.FromSlash(name))
+
+	destClean := filepath.Clean(destDir)
+	if target != destClean && !strings.HasPrefix(target, destClean+string(os.PathSeparator)) {
+		return "", fmt.Errorf("tar entry %q escapes destination directory %q", name, destDir)
+	}
+
+	return target, nil
+}
+
+// FileEventTruncated is the FileEvent value a StreamFrame carries when the
+// Nomad client detects that the file being streamed was truncated in place,
+// e.g. because it was rotated without renaming. It carries no Data.
+const FileEventTruncated = "file truncated"
+
+// FileEventDeleted is the FileEvent value a StreamFrame carries when the
+// Nomad client detects that the file being streamed was deleted. It
+// carries no Data.
+const FileEventDeleted = "file deleted"
+
+// ErrFileDeleted is sent on StreamFollow's error channel when the followed
+// file is deleted and resumeOnDelete is false.
+var ErrFileDeleted = fmt.Errorf("file deleted")
+
+// recreateWaitInterval is how often StreamFollow polls for a deleted file
+// to reappear when resumeOnDelete is true.
+const recreateWaitInterval = 250 * time.Millisecond
+
+// waitForRecreate polls Stat until path exists again or cancel fires,
+// returning false in the latter case.
+func (a *AllocFS) waitForRecreate(alloc *Allocation, path string, cancel <-chan struct{}, q *QueryOptions) bool {
+	ticker := time.NewTicker(recreateWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, _, err := a.Stat(alloc, path, q); err == nil {
+			return true
+		}
+
+		select {
+		case <-cancel:
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// StreamFollow is like Stream, but additionally watches for
+// FileEventTruncated and FileEventDeleted frames.
+//
+// A streamed file can shrink out from under a reader following it at a
+// growing offset, in which case continuing to read at that offset would
+// skip over everything written after the truncation. When StreamFollow
+// sees a FileEventTruncated frame, it resets its position to the start of
+// the file and transparently starts a new underlying Stream there, so the
+// caller keeps receiving new content instead of silently stalling past
+// the new end of file. If onTruncate is non-nil, it is called each time
+// this happens so the caller can react, e.g. to discard buffered output
+// associated with the old file contents.
+//
+// If the file is deleted outright rather than truncated, resumeOnDelete
+// controls what happens: if false, StreamFollow sends ErrFileDeleted on
+// the returned error channel and stops; if true, it polls until the file
+// is recreated at the same path and resumes following it from the start,
+// which suits log files a process recreates after deleting.
+func (a *AllocFS) StreamFollow(alloc *Allocation, path string, offset int64, onTruncate func(),
+	resumeOnDelete bool, cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+
+	frames := make(chan *StreamFrame, 10)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(frames)
+
+		for {
+			inFrames, inErrs := a.Stream(alloc, path, OriginStart, offset, cancel, q)
+
+			truncated := false
+			deleted := false
+		inner:
+			for {
+				select {
+				case f, ok := <-inFrames:
+					if !ok {
+						break inner
+					}
+					switch f.FileEvent {
+					case FileEventTruncated:
+						truncated = true
+						break inner
+					case FileEventDeleted:
+						deleted = true
+						break inner
+					}
+					offset = f.Offset + int64(len(f.Data))
+					frames <- f
+				case err := <-inErrs:
+					if err != nil {
+						errCh <- err
+					}
+					return
+				case <-cancel:
+					return
 				}
-				return
 			}
 
-			// Discard heartbeat frames
-			if frame.IsHeartbeat() {
+			if deleted {
+				if !resumeOnDelete {
+					errCh <- ErrFileDeleted
+					return
+				}
+				if !a.waitForRecreate(alloc, path, cancel, q) {
+					return
+				}
+				offset = 0
 				continue
 			}
 
-			frames <- &frame
+			if !truncated {
+				return
+			}
+
+			offset = 0
+			if onTruncate != nil {
+				onTruncate()
+			}
 		}
 	}()
 
 	return frames, errCh
 }
 
-// FrameReader is used to convert a stream of frames into a read closer.
-type FrameReader struct {
-	frames   <-chan *StreamFrame
-	errCh    <-chan error
-	cancelCh chan struct{}
+// StreamFollowWithMaxDuration is like StreamFollow, but automatically tears
+// the stream down once maxDuration has elapsed, the same way
+// StreamWithMaxDuration bounds Stream. A maxDuration <= 0 disables the limit
+// and is equivalent to calling StreamFollow directly.
+//
+// StreamFollow already closes its frames channel unconditionally once its
+// goroutine returns, including on cancellation, so an elapsed MaxDuration
+// closes the returned frames channel without sending anything on the error
+// channel -- a clean close indistinguishable from the caller cancelling the
+// stream itself.
+func (a *AllocFS) StreamFollowWithMaxDuration(alloc *Allocation, path string, offset int64, onTruncate func(),
+	resumeOnDelete bool, maxDuration time.Duration, cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
 
-	closedLock sync.Mutex
-	closed     bool
+	if maxDuration <= 0 {
+		return a.StreamFollow(alloc, path, offset, onTruncate, resumeOnDelete, cancel, q)
+	}
 
-	unblockTime time.Duration
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(maxDuration, func() { close(timeout) })
+	merged := mergeCancel(cancel, timeout)
 
-	frame       *StreamFrame
-	frameOffset int
+	frames, errCh := a.StreamFollow(alloc, path, offset, onTruncate, resumeOnDelete, merged, q)
 
-	byteOffset int
+	go func() {
+		<-merged
+		timer.Stop()
+	}()
+
+	return frames, errCh
 }
 
-// NewFrameReader takes a channel of frames and returns a FrameReader which
-// implements io.ReadCloser
-func NewFrameReader(frames <-chan *StreamFrame, errCh <-chan error, cancelCh chan struct{}) *FrameReader {
-	return &FrameReader{
-		frames:   frames,
-		errCh:    errCh,
-		cancelCh: cancelCh,
+// StreamFollowWithDiagnostics is like StreamFollow, but also writes a
+// human-readable note to cfg.Diagnostics (if set) each time it transparently
+// reconnects after the followed file is truncated, so a caller can surface
+// that lifecycle event to a user without it showing up on the error
+// channel, which is reserved for failures. cfg's other fields (besides
+// Diagnostics) are ignored; StreamFollow doesn't otherwise use StreamConfig.
+func (a *AllocFS) StreamFollowWithDiagnostics(alloc *Allocation, path string, offset int64,
+	resumeOnDelete bool, cfg StreamConfig, cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+
+	onTruncate := func() {
+		cfg.logDiagnostic("%s truncated, reconnecting from the start of the file", path)
 	}
+	return a.StreamFollow(alloc, path, offset, onTruncate, resumeOnDelete, cancel, q)
 }
 
-// SetUnblockTime sets the time to unblock and return zero bytes read. If the
-// duration is unset or is zero or less, the read will block until data is read.
-func (f *FrameReader) SetUnblockTime(d time.Duration) {
-	f.unblockTime = d
-}
+// streamWindowSampleInterval bounds how long StreamWindow samples path's
+// growth rate, via the same technique as GrowthRate, before estimating a
+// byte offset for `since`. Long enough to see a write or two from an
+// active producer, short enough not to noticeably delay StreamWindow's own
+// setup.
+const streamWindowSampleInterval = 250 * time.Millisecond
 
-// Offset returns the offset into the stream.
-func (f *FrameReader) Offset() int {
-	return f.byteOffset
+// estimateWindowOffset approximates the byte offset since ago corresponds
+// to in path, for StreamWindow. It samples path's growth rate over
+// streamWindowSampleInterval and multiplies that rate by since.Seconds()
+// to estimate the backlog size, clamped to the file's current size. If the
+// file isn't actively growing when sampled (rate <= 0), the backlog can't
+// be estimated this way, so it returns offset 0 -- the whole file -- rather
+// than guess a window that doesn't reflect the producer's real throughput.
+func (a *AllocFS) estimateWindowOffset(alloc *Allocation, path string, since time.Duration, q *QueryOptions) (int64, error) {
+	rate, err := a.GrowthRate(alloc, path, streamWindowSampleInterval, q)
+	if err != nil {
+		return 0, err
+	}
+
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return 0, err
+	}
+
+	if rate <= 0 {
+		return 0, nil
+	}
+
+	offset := info.Size - int64(rate*since.Seconds())
+	if offset < 0 {
+		offset = 0
+	}
+
+	return offset, nil
 }
 
-// Read reads the data of the incoming frames into the bytes buffer. Returns EOF
-// when there are no more frames.
-func (f *FrameReader) Read(p []byte) (n int, err error) {
-	f.closedLock.Lock()
-	closed := f.closed
-	f.closedLock.Unlock()
-	if closed {
-		return 0, io.EOF
+// StreamWindow streams approximately the last `since` of path and then
+// transitions seamlessly to live follow on the same channel -- the common
+// "last 10 minutes then live" need -- without a caller having to stitch
+// together a separate historical fetch and a live Stream itself.
+//
+// The node has no way to seek a file by time, only by byte offset, so
+// StreamWindow approximates `since` ago as a byte offset via
+// estimateWindowOffset: a short growth-rate sample multiplied by
+// since.Seconds(). This is a heuristic, not an exact cutoff -- a producer
+// that was writing faster or slower earlier in the window will make the
+// actual backlog longer or shorter than `since`. The backfill and the live
+// follow are the same underlying StreamFollow call starting from that
+// offset, so there's no gap or duplicate frame at the seam: StreamFollow's
+// own offset tracking across the transition from backlog to live data
+// applies exactly as it does for any other StreamFollow call.
+func (a *AllocFS) StreamWindow(alloc *Allocation, path string, since time.Duration,
+	cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error) {
+
+	offset, err := a.estimateWindowOffset(alloc, path, since, q)
+	if err != nil {
+		errCh := make(chan error, 1)
+		errCh <- err
+		return nil, errCh
 	}
 
-	if f.frame == nil {
-		var unblock <-chan time.Time
-		if f.unblockTime.Nanoseconds() > 0 {
-			unblock = time.After(f.unblockTime)
+	return a.StreamFollow(alloc, path, offset, nil, false, cancel, q)
+}
+
+// StreamDelta streams only the bytes appended to path since prev was taken,
+// by starting the stream at prev.Size instead of the beginning of the file.
+// If prev is nil, it streams the whole file from the start. If the file has
+// been truncated since prev (its current size is smaller than prev.Size,
+// e.g. because it was rotated in place), StreamDelta restarts from offset 0
+// instead of seeking past the new end of file, and reports this via the
+// returned truncated flag so the caller knows not to treat the stream as a
+// pure delta.
+func (a *AllocFS) StreamDelta(alloc *Allocation, path string, prev *AllocFileInfo,
+	cancel <-chan struct{}, q *QueryOptions) (<-chan *StreamFrame, <-chan error, bool) {
+
+	offset := int64(0)
+	truncated := false
+
+	if prev != nil {
+		offset = prev.Size
+
+		if info, _, err := a.Stat(alloc, path, q); err == nil && info.Size < prev.Size {
+			offset = 0
+			truncated = true
 		}
+	}
 
-		select {
-		case frame, ok := <-f.frames:
-			if !ok {
-				return 0, io.EOF
-			}
-			f.frame = frame
+	frames, errCh := a.Stream(alloc, path, OriginStart, offset, cancel, q)
+	return frames, errCh, truncated
+}
 
-			// Store the total offset into the file
-			f.byteOffset = int(f.frame.Offset)
-		case <-unblock:
-			return 0, nil
-		case err := <-f.errCh:
-			return 0, err
-		case <-f.cancelCh:
-			return 0, io.EOF
+// StreamIfModified is like Stream, but first Stats path and, if its
+// current ModTime is no newer than baseline.ModTime and its Size still
+// matches baseline.Size, reports notModified instead of opening a stream.
+// This lets a polling-plus-streaming hybrid skip the cost of opening a
+// short-lived stream during quiet periods where nothing has changed since
+// the caller's last observation. If baseline is nil, this always opens the
+// stream, the same as calling Stream directly.
+func (a *AllocFS) StreamIfModified(alloc *Allocation, path, origin string, offset int64,
+	baseline *AllocFileInfo, cancel <-chan struct{}, q *QueryOptions) (frames <-chan *StreamFrame, errCh <-chan error, notModified bool, err error) {
+
+	if baseline != nil {
+		info, _, err := a.Stat(alloc, path, q)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if !info.ModTime.After(baseline.ModTime) && info.Size == baseline.Size {
+			return nil, nil, true, nil
 		}
 	}
 
-	// Copy the data out of the frame and update our offset
-	n = copy(p, f.frame.Data[f.frameOffset:])
-	f.frameOffset += n
+	frames, errCh = a.Stream(alloc, path, origin, offset, cancel, q)
+	return frames, errCh, false, nil
+}
 
-	// Clear the frame and its offset once we have read everything
-	if len(f.frame.Data) == f.frameOffset {
-		f.frame = nil
-		f.frameOffset = 0
+// JobFS fans fs operations for a single path out across many allocations
+// at once, for debugging a job by grepping the same log path across all
+// of its allocations rather than looping over AllocFS calls by hand.
+type JobFS struct {
+	client *Client
+}
+
+// JobFS returns a handle to run fs operations across many allocations at
+// once.
+func (c *Client) JobFS() *JobFS {
+	return &JobFS{client: c}
+}
+
+// AllocFSResult is one allocation's result from a JobFS fan-out call.
+type AllocFSResult struct {
+	AllocID string
+	Content []byte
+	Err     error
+}
+
+// jobFSMaxConcurrency bounds how many allocations CatMany reads from at
+// once, so fanning out to a job with hundreds of allocations doesn't open
+// hundreds of simultaneous connections to the cluster's nodes at a time.
+const jobFSMaxConcurrency = 8
+
+// CatMany reads path from every allocation in allocs concurrently, up to
+// jobFSMaxConcurrency at a time, and returns one AllocFSResult per
+// allocation, in the order given, tagged with its AllocID. An individual
+// allocation's failure, e.g. its node being unreachable, is recorded in
+// that result's Err rather than aborting the batch, so a caller can still
+// use whichever allocations did respond.
+func (j *JobFS) CatMany(allocs []*Allocation, path string, q *QueryOptions) []*AllocFSResult {
+	results := make([]*AllocFSResult, len(allocs))
+
+	sem := make(chan struct{}, jobFSMaxConcurrency)
+	var wg sync.WaitGroup
+
+	for i, alloc := range allocs {
+		wg.Add(1)
+		go func(i int, alloc *Allocation) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result := &AllocFSResult{AllocID: alloc.ID}
+			defer func() { results[i] = result }()
+
+			r, err := j.client.AllocFS().Cat(alloc, path, q)
+			if err != nil {
+				result.Err = err
+				return
+			}
+			defer r.Close()
+
+			result.Content, result.Err = io.ReadAll(r)
+		}(i, alloc)
 	}
 
-	return n, nil
+	wg.Wait()
+	return results
 }
 
-// Close cancels the stream of frames
-func (f *FrameReader) Close() error {
-	f.closedLock.Lock()
-	defer f.closedLock.Unlock()
-	if f.closed {
-		return nil
+// tailBytesPerLineEstimate approximates how many bytes a log line takes, for
+// translating a line count into a byte offset from the end of the log --
+// the node's logs endpoint only understands a byte offset, not a line
+// count. This is the same best-effort constant the CLI's own "nomad alloc
+// logs -n" flag uses.
+const tailBytesPerLineEstimate = 120
+
+// TailJobLogLine is one line of merged output from JobFS.TailAll, tagged
+// with the allocation that produced it.
+type TailJobLogLine struct {
+	AllocID string
+	Line    string
+}
+
+// TailAll opens AllocFS.Logs for task in every allocation in allocs and
+// merges their output into a single channel, each line tagged with its
+// AllocID, up to jobFSMaxConcurrency allocations at once. If lines > 0, each
+// allocation starts approximately lines lines from the end of its log,
+// using tailBytesPerLineEstimate the same best-effort way the CLI does,
+// since the node has no line-count API; otherwise it starts from the
+// beginning. An individual allocation that fails to open or read reports
+// its error on the returned error channel, tagged with its AllocID, and
+// does not stop the rest or close the merged channel early. Closing cancel
+// tears down every allocation's tail at once.
+func (j *JobFS) TailAll(allocs []*Allocation, task, logType string, lines int, follow bool,
+	cancel <-chan struct{}, q *QueryOptions) (<-chan TailJobLogLine, <-chan error) {
+
+	out := make(chan TailJobLogLine, 10)
+	errCh := make(chan error, len(allocs))
+
+	origin := OriginStart
+	var offset int64
+	if lines > 0 {
+		origin = OriginEnd
+		offset = int64(lines) * tailBytesPerLineEstimate
 	}
 
-	close(f.cancelCh)
-	f.closed = true
-	return nil
+	sem := make(chan struct{}, jobFSMaxConcurrency)
+	var wg sync.WaitGroup
+
+	for _, alloc := range allocs {
+		wg.Add(1)
+		go func(alloc *Allocation) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			frames, frameErrs := j.client.AllocFS().Logs(alloc, follow, task, logType, origin, offset, cancel, q)
+
+			fr := NewFrameReader(frames, frameErrs, make(chan struct{}))
+			defer fr.Close()
+
+			scanner := bufio.NewScanner(fr)
+			for scanner.Scan() {
+				select {
+				case out <- TailJobLogLine{AllocID: alloc.ID, Line: scanner.Text()}:
+				case <-cancel:
+					return
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				errCh <- fmt.Errorf("%s: %w", alloc.ID, err)
+			}
+		}(alloc)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out, errCh
 }
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"sync"
+	"time"
+)
+
+// FSCache is a bounded in-memory cache of small file contents read through
+// AllocFS. It is keyed by allocation ID and path, and entries are
+// invalidated whenever the file's ModTime changes, so a cache hit never
+// returns stale content. It is safe for concurrent use.
+//
+// FSCache is opt-in: an AllocFS only consults it once SetCache has been
+// called. This keeps the common case free of the extra Stat round trip
+// needed to validate a cache entry's mtime.
+type FSCache struct {
+	maxEntries  int
+	maxBytes    int64
+	maxFileSize int64
+
+	mu       sync.Mutex
+	curBytes int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type fsCacheEntry struct {
+	key     string
+	mtime   time.Time
+	content []byte
+}
+
+// NewFSCache creates an FSCache holding at most maxEntries files, at most
+// maxBytes of content in total, and never caching a single file larger
+// than maxFileSize bytes.
+func NewFSCache(maxEntries int, maxBytes, maxFileSize int64) *FSCache {
+	return &FSCache{
+		maxEntries:  maxEntries,
+		maxBytes:    maxBytes,
+		maxFileSize: maxFileSize,
+		ll:          list.New(),
+		items:       make(map[string]*list.Element),
+	}
+}
+
+func fsCacheKey(allocID, path string) string {
+	return allocID + "\x00" + path
+}
+
+// get returns the cached content for key if present and mtime matches the
+// cached entry's mtime exactly; otherwise it reports a miss.
+func (c *FSCache) get(key string, mtime time.Time) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*fsCacheEntry)
+	if !entry.mtime.Equal(mtime) {
+		c.removeElement(elem)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(elem)
+	return entry.content, true
+}
+
+// put stores content for key, evicting the least recently used entries as
+// needed to respect maxEntries and maxBytes. Files larger than
+// maxFileSize are silently not cached.
+func (c *FSCache) put(key string, mtime time.Time, content []byte) {
+	if int64(len(content)) > c.maxFileSize {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+
+	entry := &fsCacheEntry{key: key, mtime: mtime, content: content}
+	elem := c.ll.PushFront(entry)
+	c.items[key] = elem
+	c.curBytes += int64(len(content))
+
+	for c.ll.Len() > c.maxEntries || c.curBytes > c.maxBytes {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			break
+		}
+		c.removeElement(oldest)
+	}
+}
+
+// removeElement must be called with c.mu held.
+func (c *FSCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*fsCacheEntry)
+	c.ll.Remove(elem)
+	delete(c.items, entry.key)
+	c.curBytes -= int64(len(entry.content))
+}
+
+// SetCache enables content caching for reads made through CatCached. Pass
+// nil to disable caching again.
+func (a *AllocFS) SetCache(cache *FSCache) {
+	a.cache = cache
+}
+
+// CatCached behaves like Cat, but consults the AllocFS's FSCache (set via
+// SetCache) first. It always performs a Stat to learn the file's current
+// ModTime; if that matches a cached entry the content is served from
+// memory, otherwise the file is read fresh via Cat and, if small enough,
+// stored in the cache for next time. If no cache has been configured this
+// is equivalent to Cat plus one extra Stat.
+func (a *AllocFS) CatCached(alloc *Allocation, path string, q *QueryOptions) (io.ReadCloser, error) {
+	if a.cache == nil {
+		return a.Cat(alloc, path, q)
+	}
+
+	info, _, err := a.Stat(alloc, path, q)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fsCacheKey(alloc.ID, path)
+	if content, ok := a.cache.get(key, info.ModTime); ok {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+
+	r, err := a.Cat(alloc, path, q)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	a.cache.put(key, info.ModTime, content)
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS_CatCached_HitOnUnchangedFile(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("hello cache")
+	mtime := time.Now().Truncate(time.Second)
+	var catCount int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Name: "f", Size: int64(len(content)), ModTime: mtime})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			catCount++
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	fs := client.AllocFS()
+	fs.SetCache(NewFSCache(10, 1<<20, 1<<16))
+
+	for i := 0; i < 3; i++ {
+		r, err := fs.CatCached(alloc, "f", nil)
+		require.NoError(t, err)
+		got, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		require.Equal(t, content, got)
+	}
+
+	require.Equal(t, 1, catCount)
+}
+
+func TestFS_CatCached_InvalidatesOnMTimeChange(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Now().Truncate(time.Second)
+	content := []byte("version one")
+	var catCount int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Name: "f", Size: int64(len(content)), ModTime: mtime})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			catCount++
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	fs := client.AllocFS()
+	fs.SetCache(NewFSCache(10, 1<<20, 1<<16))
+
+	r, err := fs.CatCached(alloc, "f", nil)
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, content, got)
+	require.Equal(t, 1, catCount)
+
+	mtime = mtime.Add(time.Minute)
+	content = []byte("version two, newer")
+
+	r, err = fs.CatCached(alloc, "f", nil)
+	require.NoError(t, err)
+	got, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, content, got)
+	require.Equal(t, 2, catCount)
+}
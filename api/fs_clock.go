@@ -0,0 +1,54 @@
+package api
+
+import "time"
+
+// clock abstracts time so AllocFS's time-dependent behavior -- timeouts,
+// heartbeat detection, retry backoff -- can be driven deterministically in
+// tests instead of requiring real sleeps. AllocFS defaults to realClock;
+// tests substitute a fake via the unexported clock field. This is an
+// enabling abstraction: not every time-based AllocFS method goes through it
+// yet, only those that need deterministic tests.
+type clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) clockTimer
+}
+
+// clockTimer abstracts *time.Timer so a fake clock can control when it
+// fires without a real sleep.
+type clockTimer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// realClock is the default clock, backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) clockTimer {
+	return &realTimer{t: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (r *realTimer) C() <-chan time.Time        { return r.t.C }
+func (r *realTimer) Stop() bool                 { return r.t.Stop() }
+func (r *realTimer) Reset(d time.Duration) bool { return r.t.Reset(d) }
+
+// clock returns a's configured clock, defaulting to realClock{} if none was
+// set via setClock.
+func (a *AllocFS) clock() clock {
+	if a.clk == nil {
+		return realClock{}
+	}
+	return a.clk
+}
+
+// setClock overrides a's clock, for deterministic tests. Unexported: this
+// is a testing seam, not a public extension point.
+func (a *AllocFS) setClock(c clock) {
+	a.clk = c
+}
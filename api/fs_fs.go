@@ -0,0 +1,129 @@
+package api
+
+import (
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// FS returns an fs.FS rooted at the allocation directory of alloc, so
+// standard library helpers like fs.WalkDir and fs.ReadFile can be used
+// against a running allocation's files the same way they're used against a
+// local directory tree.
+func (a *AllocFS) FS(alloc *Allocation, q *QueryOptions) fs.FS {
+	return &allocFS{afs: a, alloc: alloc, q: q}
+}
+
+// allocFS implements fs.FS over the AllocFS List/Stat/Cat endpoints.
+type allocFS struct {
+	afs   *AllocFS
+	alloc *Allocation
+	q     *QueryOptions
+}
+
+func (a *allocFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	path := name
+	if path == "." {
+		path = "/"
+	}
+
+	info, _, err := a.afs.Stat(a.alloc, path, a.q)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	if info.IsDir {
+		entries, _, err := a.afs.List(a.alloc, path, a.q)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		return &allocDir{name: name, info: info, entries: entries}, nil
+	}
+
+	r, err := a.afs.Cat(a.alloc, path, a.q)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &allocFile{name: name, info: info, r: r}, nil
+}
+
+// allocFileInfo adapts an AllocFileInfo to fs.FileInfo.
+type allocFileInfo struct {
+	name string
+	info *AllocFileInfo
+}
+
+func (i *allocFileInfo) Name() string { return i.name }
+func (i *allocFileInfo) Size() int64  { return i.info.Size }
+func (i *allocFileInfo) ModTime() time.Time { return i.info.ModTime }
+func (i *allocFileInfo) IsDir() bool  { return i.info.IsDir }
+func (i *allocFileInfo) Sys() interface{} { return i.info }
+
+func (i *allocFileInfo) Mode() fs.FileMode {
+	mode, err := i.info.FileModeBits()
+	if err != nil {
+		return 0
+	}
+	return mode
+}
+
+// allocFileInfo also implements fs.DirEntry so List results can be returned
+// directly from allocDir.ReadDir.
+func (i *allocFileInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i *allocFileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// allocFile implements fs.File for a regular file in the alloc directory.
+type allocFile struct {
+	name string
+	info *AllocFileInfo
+	r    io.ReadCloser
+}
+
+func (f *allocFile) Stat() (fs.FileInfo, error) { return &allocFileInfo{name: f.name, info: f.info}, nil }
+func (f *allocFile) Read(p []byte) (int, error) { return f.r.Read(p) }
+func (f *allocFile) Close() error               { return f.r.Close() }
+
+// allocDir implements fs.ReadDirFile for a directory in the alloc directory.
+type allocDir struct {
+	name    string
+	info    *AllocFileInfo
+	entries []*AllocFileInfo
+	offset  int
+}
+
+func (d *allocDir) Stat() (fs.FileInfo, error) { return &allocFileInfo{name: d.name, info: d.info}, nil }
+func (d *allocDir) Close() error               { return nil }
+
+func (d *allocDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+func (d *allocDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := len(d.entries) - d.offset
+	if remaining <= 0 {
+		if n <= 0 {
+			return nil, nil
+		}
+		return nil, io.EOF
+	}
+
+	if n <= 0 || n > remaining {
+		n = remaining
+	}
+
+	out := make([]fs.DirEntry, n)
+	for i := 0; i < n; i++ {
+		entry := d.entries[d.offset+i]
+		out[i] = &allocFileInfo{name: entry.Name, info: entry}
+	}
+	d.offset += n
+
+	return out, nil
+}
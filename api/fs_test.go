@@ -1,13 +1,32 @@
 package api
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	gopath "path"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	units "github.com/docker/go-units"
 	"github.com/hashicorp/nomad/api/internal/testutil"
@@ -159,133 +178,6900 @@ func TestFS_Logs(t *testing.T) {
 	}
 }
 
+func TestFS_ScanArchivedLog(t *testing.T) {
+	t.Parallel()
+
+	want := []string{"line one", "line two", "line three"}
+	var archive bytes.Buffer
+	gzw := gzip.NewWriter(&archive)
+	for _, line := range want {
+		fmt.Fprintf(gzw, "%s\n", line)
+	}
+	require.NoError(t, gzw.Close())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			w.Write(archive.Bytes())
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	lines, errCh := client.AllocFS().ScanArchivedLog(alloc, "alloc/logs/app.log.gz", nil)
+
+	var got []string
+READ:
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				break READ
+			}
+			got = append(got, line)
+		case err := <-errCh:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	require.Equal(t, want, got)
+}
+
+// TestFS_ScanArchivedLog_MultipleGzipMembers covers the doc comment's claim
+// that archives made of several concatenated gzip members - as produced by
+// e.g. `cat a.gz b.gz > combined.gz` - are read transparently, rather than
+// stopping after the first member.
+func TestFS_ScanArchivedLog_MultipleGzipMembers(t *testing.T) {
+	t.Parallel()
+
+	want := []string{"line one", "line two", "line three", "line four"}
+
+	var archive bytes.Buffer
+	for _, lines := range [][]string{want[:2], want[2:]} {
+		gzw := gzip.NewWriter(&archive)
+		for _, line := range lines {
+			fmt.Fprintf(gzw, "%s\n", line)
+		}
+		require.NoError(t, gzw.Close())
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			w.Write(archive.Bytes())
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	lines, errCh := client.AllocFS().ScanArchivedLog(alloc, "alloc/logs/app.log.gz", nil)
+
+	var got []string
+READ:
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				break READ
+			}
+			got = append(got, line)
+		case err := <-errCh:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	require.Equal(t, want, got)
+}
+
+func TestFS_List_UserAgent(t *testing.T) {
+	t.Parallel()
+
+	var gotUserAgent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserAgent = r.Header.Get("User-Agent")
+		w.Header().Set("X-Nomad-Index", "1")
+		w.Header().Set("X-Nomad-LastContact", "0")
+		w.Header().Set("X-Nomad-KnownLeader", "true")
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	_, _, err = client.AllocFS().List(alloc, "/", nil)
+	require.NoError(t, err)
+	require.Equal(t, defaultUserAgent, gotUserAgent)
+
+	conf.UserAgent = "my-tool/1.2.3"
+	client, err = NewClient(conf)
+	require.NoError(t, err)
+	_, _, err = client.AllocFS().List(alloc, "/", nil)
+	require.NoError(t, err)
+	require.Equal(t, "my-tool/1.2.3", gotUserAgent)
+}
+
+func TestFS_List_ContentTypeNegotiation(t *testing.T) {
+	t.Parallel()
+
+	var gotAccept string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAccept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]*AllocFileInfo{{Name: "a.txt", Size: 5}})
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	entries, _, err := client.AllocFS().List(alloc, "/", nil)
+	require.NoError(t, err)
+	require.Equal(t, "application/json", gotAccept)
+	require.Len(t, entries, 1)
+	require.Equal(t, "a.txt", entries[0].Name)
+}
+
+func TestFS_List_UnsupportedContentTypeRejected(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/msgpack")
+		w.Write([]byte{0x90})
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	_, _, err = client.AllocFS().List(alloc, "/", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported List response Content-Type")
+}
+
+func TestFS_CombinedLogs(t *testing.T) {
+	t.Parallel()
+
+	frame := func(data string) []byte {
+		b, err := json.Marshal(&StreamFrame{Data: []byte(data)})
+		require.NoError(t, err)
+		return b
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/logs/") {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Query().Get("type") {
+		case "stdout":
+			w.Write(frame("out1\nout2\n"))
+		case "stderr":
+			w.Write(frame("err1\nerr2\n"))
+		}
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	rc, err := client.AllocFS().CombinedLogs(alloc, "task", true, false, cancel, nil)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	out, err := io.ReadAll(rc)
+	require.NoError(t, err)
+
+	require.Contains(t, string(out), "out1\nout2\n")
+	require.Contains(t, string(out), "stderr: err1\nstderr: err2\n")
+}
+
+// TestFS_CombinedLogs_CloseStopsUnderlyingStreams ensures that closing the
+// io.ReadCloser CombinedLogs returns is, by itself, enough to tear down the
+// two underlying a.Logs() streams - without the caller also having to close
+// the cancel channel it passed in.
+func TestFS_CombinedLogs_CloseStopsUnderlyingStreams(t *testing.T) {
+	t.Parallel()
+
+	var once sync.Once
+	requestClosed := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/logs/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		for i := 0; ; i++ {
+			select {
+			case <-r.Context().Done():
+				once.Do(func() { close(requestClosed) })
+				return
+			default:
+			}
+			require.NoError(t, enc.Encode(&StreamFrame{Data: []byte(fmt.Sprintf("line%d\n", i))}))
+			if flusher != nil {
+				flusher.Flush()
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	rc, err := client.AllocFS().CombinedLogs(alloc, "task", false, true, cancel, nil)
+	require.NoError(t, err)
+
+	buf := make([]byte, 16)
+	_, err = rc.Read(buf)
+	require.NoError(t, err)
+
+	require.NoError(t, rc.Close())
+
+	select {
+	case <-requestClosed:
+		// closing rc alone stopped the underlying stream, as expected.
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing the returned reader did not stop the underlying log streams")
+	}
+}
+
+func TestFS_Stream_CleanEOF(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.Marshal(&StreamFrame{Data: []byte("hello")})
+		require.NoError(t, err)
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, errCh := client.AllocFS().Stream(alloc, "log", OriginStart, 0, cancel, nil)
+
+	var got []byte
+READ:
+	for {
+		select {
+		case f, ok := <-frames:
+			if !ok {
+				break READ
+			}
+			got = append(got, f.Data...)
+		case err := <-errCh:
+			t.Fatalf("unexpected error on clean stream end: %v", err)
+		}
+	}
+	require.Equal(t, "hello", string(got))
+}
+
+func TestFS_StreamCtx_CancelStopsGoroutineWithoutDraining(t *testing.T) {
+	t.Parallel()
+
+	serverDone := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		for i := 0; i < 10000; i++ {
+			select {
+			case <-r.Context().Done():
+				close(serverDone)
+				return
+			default:
+			}
+			if err := enc.Encode(&StreamFrame{Data: []byte("x")}); err != nil {
+				close(serverDone)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames, _ := client.AllocFS().StreamCtx(ctx, alloc, "log", OriginStart, 0, nil)
+	_ = frames // intentionally never drained
+
+	// Give the producer goroutine time to fill the frames buffer and block
+	// trying to send another one, then cancel. The server only sees the
+	// client disconnect if that blocked send actually unblocks and the
+	// goroutine tears the connection down; if it leaked (blocked forever
+	// on a send nobody will ever read), the server keeps streaming.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-serverDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server never observed the client disconnect; stream goroutine leaked")
+	}
+}
+
+func TestFS_Stream_AbnormalDisconnect(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Write a truncated frame and then sever the connection, rather
+		// than closing it cleanly, to simulate a dropped connection.
+		w.Write([]byte(`{"Data":"aGVsbG8=",`))
+		hj, ok := w.(http.Hijacker)
+		require.True(t, ok)
+		conn, _, err := hj.Hijack()
+		require.NoError(t, err)
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, errCh := client.AllocFS().Stream(alloc, "log", OriginStart, 0, cancel, nil)
+
+	// The error is sent on errCh before frames is closed, so waiting for
+	// frames to close first guarantees the error is already buffered.
+	select {
+	case f, ok := <-frames:
+		if ok {
+			t.Fatalf("unexpected frame: %v", f)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for frames to close")
+	}
+
+	select {
+	case err := <-errCh:
+		require.Error(t, err)
+		require.NotEqual(t, io.EOF, err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for error")
+	}
+}
+
+// memWriterAt is a minimal io.WriterAt backed by an in-memory buffer, used
+// to assert the contents DownloadResumable assembles.
+type memWriterAt struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (m *memWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if end := int(off) + len(p); end > len(m.buf) {
+		grown := make([]byte, end)
+		copy(grown, m.buf)
+		m.buf = grown
+	}
+	copy(m.buf[off:], p)
+	return len(p), nil
+}
+
+func TestFS_DownloadResumable(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("0123456789")
+	var failOnceMu sync.Mutex
+	failedOffsets := make(map[string]bool)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Size: int64(len(content))})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+			offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+			limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+
+			key := r.URL.Query().Get("offset")
+			failOnceMu.Lock()
+			alreadyFailed := failedOffsets[key]
+			failedOffsets[key] = true
+			failOnceMu.Unlock()
+
+			if offset == 4 && !alreadyFailed {
+				http.Error(w, "simulated transient failure", http.StatusInternalServerError)
+				return
+			}
+
+			end := offset + limit
+			if end > int64(len(content)) {
+				end = int64(len(content))
+			}
+			w.Write(content[offset:end])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	out := &memWriterAt{}
+
+	err = client.AllocFS().DownloadResumable(alloc, "file.bin", out, 4, nil)
+	require.NoError(t, err)
+	require.Equal(t, content, out.buf)
+}
+
+func TestFS_DownloadResumable_FallsBackOnChunkedNode(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("the quick brown fox jumps over the lazy dog")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Size: int64(len(content))})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+			// Simulate a node whose handler streams the whole remaining
+			// file via chunked transfer encoding, ignoring the requested
+			// offset/limit entirely.
+			offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+			w.Write(content[offset:])
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	out := &memWriterAt{}
+
+	err = client.AllocFS().DownloadResumable(alloc, "file.bin", out, 4, nil)
+	require.NoError(t, err)
+	require.Equal(t, content, out.buf)
+}
+
+func TestFS_IsEmptyFile(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			var size int64
+			if r.URL.Query().Get("path") == "full.txt" {
+				size = 42
+			}
+			b, _ := json.Marshal(&AllocFileInfo{Size: size})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			// Deliberately write nothing: a zero-byte Cat response should
+			// read back cleanly as io.EOF, not as an error.
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	empty, err := client.AllocFS().IsEmptyFile(alloc, "empty.txt", nil)
+	require.NoError(t, err)
+	require.True(t, empty)
+
+	notEmpty, err := client.AllocFS().IsEmptyFile(alloc, "full.txt", nil)
+	require.NoError(t, err)
+	require.False(t, notEmpty)
+
+	r, err := client.AllocFS().Cat(alloc, "empty.txt", nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Empty(t, data)
+}
+
+func TestFS_WriteFileTo(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("hello s3")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Size: int64(len(content)), ContentType: "text/plain"})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	var buf bytes.Buffer
+	contentType, err := client.AllocFS().WriteFileTo(alloc, "file.txt", &buf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", contentType)
+	require.Equal(t, content, buf.Bytes())
+}
+
+func TestFS_WaitForMinSize(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		size := int64(n) * 10
+		b, _ := json.Marshal(&AllocFileInfo{Size: size})
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := client.AllocFS().WaitForMinSize(ctx, alloc, "growing.log", 25, 10*time.Millisecond, nil)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, info.Size, int64(25))
+}
+
+func TestFS_WaitForMinSize_ContextTimeout(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := json.Marshal(&AllocFileInfo{Size: 1})
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = client.AllocFS().WaitForMinSize(ctx, alloc, "growing.log", 1000, 10*time.Millisecond, nil)
+	require.Error(t, err)
+}
+
+// TestFS_WaitForContent_MatchBeforeDeadline verifies that WaitForContent
+// returns true as soon as a line satisfying pred arrives, without waiting
+// out the rest of maxWait.
+func TestFS_WaitForContent_MatchBeforeDeadline(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("starting\nREADY\nmore\n")}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	start := time.Now()
+	ok, err := client.AllocFS().WaitForContent(alloc, "log", func(line string) bool {
+		return line == "READY"
+	}, 2*time.Second, nil, nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, time.Since(start) < 2*time.Second)
+}
+
+// TestFS_WaitForContent_TimesOut verifies that WaitForContent returns
+// false, without error, once maxWait elapses and no matching line has
+// arrived.
+func TestFS_WaitForContent_TimesOut(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		for i := 0; ; i++ {
+			select {
+			case <-r.Context().Done():
+				return
+			default:
+			}
+			require.NoError(t, enc.Encode(&StreamFrame{Data: []byte(fmt.Sprintf("waiting%d\n", i))}))
+			if flusher != nil {
+				flusher.Flush()
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	ok, err := client.AllocFS().WaitForContent(alloc, "log", func(line string) bool {
+		return line == "READY"
+	}, 50*time.Millisecond, nil, nil)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestAllocFileInfo_FileModeBits(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		mode string
+		want os.FileMode
+	}{
+		{"-rw-r--r--", 0644},
+		{"-rwxr-xr-x", 0755},
+		{"drwxr-xr-x", os.ModeDir | 0755},
+	}
+
+	for _, c := range cases {
+		info := &AllocFileInfo{FileMode: c.mode}
+		got, err := info.FileModeBits()
+		require.NoError(t, err)
+		require.Equal(t, c.want, got)
+	}
+
+	_, err := (&AllocFileInfo{FileMode: "bogus"}).FileModeBits()
+	require.Error(t, err)
+}
+
+func TestAllocFileInfo_ToOSFileInfo(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Now().Truncate(time.Second)
+	info := &AllocFileInfo{
+		Name:     "config.conf",
+		IsDir:    false,
+		Size:     42,
+		FileMode: "-rw-r--r--",
+		ModTime:  mtime,
+	}
+
+	var fi os.FileInfo
+	fi, err := info.ToOSFileInfo()
+	require.NoError(t, err)
+	require.Equal(t, "config.conf", fi.Name())
+	require.Equal(t, int64(42), fi.Size())
+	require.Equal(t, os.FileMode(0644), fi.Mode())
+	require.True(t, mtime.Equal(fi.ModTime()))
+	require.False(t, fi.IsDir())
+	require.Equal(t, info, fi.Sys())
+
+	dirInfo := &AllocFileInfo{Name: "logs", IsDir: true, FileMode: "drwxr-xr-x"}
+	dirFi, err := dirInfo.ToOSFileInfo()
+	require.NoError(t, err)
+	require.True(t, dirFi.IsDir())
+	require.Equal(t, os.ModeDir|0755, dirFi.Mode())
+
+	_, err = (&AllocFileInfo{FileMode: "bogus"}).ToOSFileInfo()
+	require.Error(t, err)
+}
+
+func TestFS_Cat_RetryableStatusCodes(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			http.NotFound(w, r)
+			return
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	q := &QueryOptions{RetryableStatusCodes: []int{http.StatusServiceUnavailable}}
+
+	r, err := client.AllocFS().Cat(alloc, "file.txt", q)
+	require.NoError(t, err)
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(data))
+	require.EqualValues(t, 2, atomic.LoadInt32(&calls))
+}
+
+func TestFS_Cat_NodeStartupTimeout_RetriesTransient404(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			http.NotFound(w, r)
+			return
+		}
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	q := &QueryOptions{NodeStartupTimeout: time.Second}
+
+	r, err := client.AllocFS().Cat(alloc, "file.txt", q)
+	require.NoError(t, err)
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(data))
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+}
+
+func TestFS_Cat_NodeStartupTimeout_PermanentNotFoundGivesUp(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	q := &QueryOptions{NodeStartupTimeout: 50 * time.Millisecond}
+
+	_, err = client.AllocFS().Cat(alloc, "file.txt", q)
+	require.Error(t, err)
+	require.True(t, isNotFoundError(err), "expected a 404 error, got: %v", err)
+}
+
+func TestFS_Cat_NonRetryableStatusFailsImmediately(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	_, err = client.AllocFS().Cat(alloc, "file.txt", nil)
+	require.Error(t, err)
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
+
+func TestFS_ReadJSON_DecodesFixture(t *testing.T) {
+	t.Parallel()
+
+	type stats struct {
+		CPU    float64 `json:"cpu"`
+		Memory int64   `json:"memory"`
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			w.Write([]byte(`{"cpu": 1.5, "memory": 2048}`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	var got stats
+	require.NoError(t, client.AllocFS().ReadJSON(alloc, "alloc/stats.json", &got, nil))
+	require.Equal(t, stats{CPU: 1.5, Memory: 2048}, got)
+}
+
+func TestFS_ReadJSON_MalformedJSON(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			w.Write([]byte(`{"cpu": not-json`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	var got map[string]interface{}
+	err = client.AllocFS().ReadJSON(alloc, "alloc/stats.json", &got, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "alloc/stats.json")
+	require.Contains(t, err.Error(), "invalid JSON")
+}
+
+func TestFS_ReadJSON_TooLarge(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			w.Write([]byte(`{"padding": "` + strings.Repeat("x", 64) + `"}`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	config.MaxFSResponseBytes = 8
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	var got map[string]interface{}
+	err = client.AllocFS().ReadJSON(alloc, "alloc/stats.json", &got, nil)
+	require.Error(t, err)
+	var tooLarge *ErrResponseTooLarge
+	require.True(t, errors.As(err, &tooLarge))
+}
+
+func TestFS_StreamWithResult(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := json.Marshal(&StreamFrame{Data: []byte("hello")})
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, result := client.AllocFS().StreamWithResult(alloc, "log", OriginStart, 0, cancel, nil)
+
+	var got []byte
+	for f := range frames {
+		got = append(got, f.Data...)
+	}
+	require.Equal(t, "hello", string(got))
+
+	res := <-result
+	require.Equal(t, StreamStateEOF, res.State)
+	require.NoError(t, res.Err)
+}
+
+func TestFS_Stream_ConnectRetrySucceedsAfter503s(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			http.NotFound(w, r)
+			return
+		}
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := json.Marshal(&StreamFrame{Data: []byte("hello")})
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	q := &QueryOptions{
+		ConnectRetryStatusCodes: []int{http.StatusServiceUnavailable},
+		ConnectRetryMaxDuration: 5 * time.Second,
+	}
+
+	frames, errCh := client.AllocFS().Stream(alloc, "log", OriginStart, 0, cancel, q)
+
+	var got []byte
+	for f := range frames {
+		got = append(got, f.Data...)
+	}
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	default:
+	}
+
+	require.Equal(t, "hello", string(got))
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+}
+
+func TestFS_Stream_ConnectRetryGivesUpOnUnlistedStatus(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	q := &QueryOptions{
+		ConnectRetryStatusCodes: []int{http.StatusServiceUnavailable},
+		ConnectRetryMaxDuration: 5 * time.Second,
+	}
+
+	_, errCh := client.AllocFS().Stream(alloc, "log", OriginStart, 0, cancel, q)
+	require.Error(t, <-errCh)
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
+
+func TestFS_Stream_SetupTimesOutOnSlowConnect(t *testing.T) {
+	t.Parallel()
+
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			http.NotFound(w, r)
+			return
+		}
+		<-unblock
+		b, _ := json.Marshal(&StreamFrame{Data: []byte("too late")})
+		w.Write(b)
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	q := &QueryOptions{SetupTimeout: 50 * time.Millisecond}
+
+	frames, errCh := client.AllocFS().Stream(alloc, "log", OriginStart, 0, cancel, q)
+	require.Nil(t, frames)
+
+	err = <-errCh
+	var timeout *ErrStreamSetupTimeout
+	require.True(t, errors.As(err, &timeout))
+	require.Equal(t, 50*time.Millisecond, timeout.Timeout)
+}
+
+func TestFS_FS(t *testing.T) {
+	t.Parallel()
+
+	type node struct {
+		info    AllocFileInfo
+		content string
+		entries []string
+	}
+
+	tree := map[string]node{
+		"/": {
+			info:    AllocFileInfo{Name: "/", IsDir: true, FileMode: "drwxr-xr-x"},
+			entries: []string{"a.txt", "sub"},
+		},
+		"a.txt": {
+			info:    AllocFileInfo{Name: "a.txt", FileMode: "-rw-r--r--"},
+			content: "hello",
+		},
+		"sub": {
+			info:    AllocFileInfo{Name: "sub", IsDir: true, FileMode: "drwxr-xr-x"},
+			entries: []string{"b.txt"},
+		},
+		"sub/b.txt": {
+			info:    AllocFileInfo{Name: "b.txt", FileMode: "-rw-r--r--"},
+			content: "world",
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		n, ok := tree[path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		n.info.Size = int64(len(n.content))
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&n.info)
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			var infos []*AllocFileInfo
+			for _, name := range n.entries {
+				child := tree[strings.TrimPrefix(path+"/"+name, "//")]
+				child.info.Size = int64(len(child.content))
+				info := child.info
+				infos = append(infos, &info)
+			}
+			b, _ := json.Marshal(infos)
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			w.Write([]byte(n.content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	fsys := client.AllocFS().FS(alloc, nil)
+
+	data, err := fs.ReadFile(fsys, "a.txt")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	var found []string
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		require.NoError(t, err)
+		if !d.IsDir() {
+			found = append(found, path)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"a.txt", "sub/b.txt"}, found)
+}
+
 func TestFS_FrameReader(t *testing.T) {
 	t.Parallel()
-	// Create a channel of the frames and a cancel channel
-	framesCh := make(chan *StreamFrame, 3)
-	errCh := make(chan error)
-	cancelCh := make(chan struct{})
+	// Create a channel of the frames and a cancel channel
+	framesCh := make(chan *StreamFrame, 3)
+	errCh := make(chan error)
+	cancelCh := make(chan struct{})
+
+	r := NewFrameReader(framesCh, errCh, cancelCh)
+
+	// Create some frames and send them
+	f1 := &StreamFrame{
+		File:   "foo",
+		Offset: 5,
+		Data:   []byte("hello"),
+	}
+	f2 := &StreamFrame{
+		File:   "foo",
+		Offset: 10,
+		Data:   []byte(", wor"),
+	}
+	f3 := &StreamFrame{
+		File:   "foo",
+		Offset: 12,
+		Data:   []byte("ld"),
+	}
+	framesCh <- f1
+	framesCh <- f2
+	framesCh <- f3
+	close(framesCh)
+
+	expected := []byte("hello, world")
+
+	// Read a little
+	p := make([]byte, 12)
+
+	n, err := r.Read(p[:5])
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if off := r.Offset(); off != n {
+		t.Fatalf("unexpected read bytes: got %v; wanted %v", n, off)
+	}
+
+	off := n
+	for {
+		n, err = r.Read(p[off:])
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatalf("Read failed: %v", err)
+		}
+		off += n
+	}
+
+	if !reflect.DeepEqual(p, expected) {
+		t.Fatalf("read %q, wanted %q", string(p), string(expected))
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if _, ok := <-cancelCh; ok {
+		t.Fatalf("Close() didn't close cancel channel")
+	}
+	if len(expected) != r.Offset() {
+		t.Fatalf("offset %d, wanted %d", r.Offset(), len(expected))
+	}
+}
+
+func TestFS_FrameReader_Unblock(t *testing.T) {
+	t.Parallel()
+	// Create a channel of the frames and a cancel channel
+	framesCh := make(chan *StreamFrame, 3)
+	errCh := make(chan error)
+	cancelCh := make(chan struct{})
+
+	r := NewFrameReader(framesCh, errCh, cancelCh)
+	r.SetUnblockTime(10 * time.Millisecond)
+
+	// Read a little
+	p := make([]byte, 12)
+
+	n, err := r.Read(p)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if n != 0 {
+		t.Fatalf("should have unblocked")
+	}
+
+	// Unset the unblock
+	r.SetUnblockTime(0)
+
+	resultCh := make(chan struct{})
+	go func() {
+		r.Read(p)
+		close(resultCh)
+	}()
+
+	select {
+	case <-resultCh:
+		t.Fatalf("shouldn't have unblocked")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestFS_FrameReader_Error(t *testing.T) {
+	t.Parallel()
+	// Create a channel of the frames and a cancel channel
+	framesCh := make(chan *StreamFrame, 3)
+	errCh := make(chan error, 1)
+	cancelCh := make(chan struct{})
+
+	r := NewFrameReader(framesCh, errCh, cancelCh)
+	r.SetUnblockTime(10 * time.Millisecond)
+
+	// Send an error
+	expected := fmt.Errorf("test error")
+	errCh <- expected
+
+	// Read a little
+	p := make([]byte, 12)
+
+	_, err := r.Read(p)
+	if err == nil || !strings.Contains(err.Error(), expected.Error()) {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestFS_WaitForTaskExit(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/allocation/abc123" {
+			http.NotFound(w, r)
+			return
+		}
+
+		alloc := &Allocation{ID: "abc123"}
+		if atomic.AddInt32(&calls, 1) < 2 {
+			alloc.TaskStates = map[string]*TaskState{
+				"web": {Events: []*TaskEvent{{Type: TaskStarted}}},
+			}
+		} else {
+			alloc.TaskStates = map[string]*TaskState{
+				"web": {Events: []*TaskEvent{
+					{Type: TaskStarted},
+					{Type: TaskTerminated, ExitCode: 1, Signal: 9},
+				}},
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(alloc)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123"}
+	result, err := client.AllocFS().WaitForTaskExit(context.Background(), alloc, "web", 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, 1, result.ExitCode)
+	require.Equal(t, 9, result.Signal)
+}
+
+func TestFS_WaitForTaskExit_ContextTimeout(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alloc := &Allocation{ID: "abc123", TaskStates: map[string]*TaskState{
+			"web": {Events: []*TaskEvent{{Type: TaskStarted}}},
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(alloc)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	alloc := &Allocation{ID: "abc123"}
+	_, err = client.AllocFS().WaitForTaskExit(ctx, alloc, "web", 10*time.Millisecond)
+	require.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestTaskExitResult_Err(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		result  *TaskExitResult
+		wantErr string
+	}{
+		{name: "clean exit", result: &TaskExitResult{ExitCode: 0}, wantErr: ""},
+		{name: "non-zero exit", result: &TaskExitResult{ExitCode: 2}, wantErr: "task exited with code 2"},
+		{name: "signaled", result: &TaskExitResult{ExitCode: -1, Signal: 9}, wantErr: "task killed by signal 9"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.result.Err()
+			if c.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, c.wantErr)
+		})
+	}
+}
+
+func TestFS_Check(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		statStatus int
+		wantResult *CheckResult
+		wantErr    bool
+	}{
+		{
+			name:       "success",
+			statStatus: http.StatusOK,
+			wantResult: &CheckResult{NodeAddressResolved: true, AuthOK: true, PathExists: true},
+		},
+		{
+			name:       "forbidden",
+			statStatus: http.StatusForbidden,
+			wantResult: &CheckResult{NodeAddressResolved: true, AuthOK: false, PathExists: false},
+			wantErr:    true,
+		},
+		{
+			name:       "not found",
+			statStatus: http.StatusNotFound,
+			wantResult: &CheckResult{NodeAddressResolved: true, AuthOK: true, PathExists: false},
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/v1/node/unknown":
+					w.Header().Set("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(&Node{ID: "unknown", HTTPAddr: "127.0.0.1:1", Status: "ready"})
+				case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+					if tc.statStatus != http.StatusOK {
+						w.WriteHeader(tc.statStatus)
+						return
+					}
+					w.Header().Set("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(&AllocFileInfo{Name: "foo", Size: 1})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer ts.Close()
+
+			config := DefaultConfig()
+			config.Address = ts.URL
+			client, err := NewClient(config)
+			require.NoError(t, err)
+
+			alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+			result, err := client.AllocFS().Check(alloc, "foo", nil)
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.wantResult, result)
+		})
+	}
+}
+
+func TestFS_Check_NoHTTPAddr(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/node/unknown" {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(&Node{ID: "unknown", Status: "ready"})
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	result, err := client.AllocFS().Check(alloc, "foo", nil)
+	require.Error(t, err)
+	require.False(t, result.NodeAddressResolved)
+}
+
+func TestFS_StreamSSE(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "data: {\"Data\":\"AQID\",\"Offset\":3}\n\n")
+		fmt.Fprint(w, "data: {\"Data\":\"BAUG\",\"Offset\":6}\n\n")
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, errCh := client.AllocFS().StreamSSE(alloc, "foo", OriginStart, 0, cancel, nil)
+
+	var got []*StreamFrame
+	for frame := range frames {
+		got = append(got, frame)
+	}
+
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	default:
+	}
+
+	require.Len(t, got, 2)
+	require.Equal(t, []byte{1, 2, 3}, got[0].Data)
+	require.Equal(t, int64(3), got[0].Offset)
+	require.Equal(t, []byte{4, 5, 6}, got[1].Data)
+	require.Equal(t, int64(6), got[1].Offset)
+}
+
+func TestFS_StreamSSE_FallsBackToJSON(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(&StreamFrame{Data: []byte("hi"), Offset: 2})
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, _ := client.AllocFS().StreamSSE(alloc, "foo", OriginStart, 0, cancel, nil)
+
+	frame := <-frames
+	require.Equal(t, []byte("hi"), frame.Data)
+}
+
+func fsLastLineServer(t *testing.T, content []byte) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Size: int64(len(content))})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+			offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+			limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+			end := offset + limit
+			if end > int64(len(content)) {
+				end = int64(len(content))
+			}
+			w.Write(content[offset:end])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestFS_LastLine(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("line one\nline two\nline three\n")
+	ts := fsLastLineServer(t, content)
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	line, err := client.AllocFS().LastLine(alloc, "foo", nil)
+	require.NoError(t, err)
+	require.Equal(t, "line three", line)
+}
+
+func TestFS_LastLine_HugeLastLine(t *testing.T) {
+	t.Parallel()
+
+	huge := strings.Repeat("x", 10*lastLineInitialWindow)
+	content := []byte("short\n" + huge)
+	ts := fsLastLineServer(t, content)
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	line, err := client.AllocFS().LastLine(alloc, "foo", nil)
+	require.NoError(t, err)
+	require.Equal(t, huge, line)
+}
+
+func TestFS_LastLine_SingleLine(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("the only line")
+	ts := fsLastLineServer(t, content)
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	line, err := client.AllocFS().LastLine(alloc, "foo", nil)
+	require.NoError(t, err)
+	require.Equal(t, "the only line", line)
+}
+
+func TestFS_Hash_MatchesKnownDigest(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("the quick brown fox jumps over the lazy dog")
+	want := sha256.Sum256(content)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(content)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	got, err := client.AllocFS().Hash(alloc, "foo", sha256.New(), nil)
+	require.NoError(t, err)
+	require.Equal(t, want[:], got)
+}
+
+func TestFS_ReadAtBuf_FullFill(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("0123456789")
+	ts := fsLastLineServer(t, content)
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	p := make([]byte, 5)
+	n, err := client.AllocFS().ReadAtBuf(context.Background(), alloc, "foo", p, 2, nil)
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	require.Equal(t, "23456", string(p))
+}
+
+func TestFS_ReadAtBuf_ShortReadAtEOF(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("0123456789")
+	ts := fsLastLineServer(t, content)
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	p := make([]byte, 5)
+	n, err := client.AllocFS().ReadAtBuf(context.Background(), alloc, "foo", p, 7, nil)
+	require.True(t, errors.Is(err, io.EOF))
+	require.Equal(t, 3, n)
+	require.Equal(t, "789", string(p[:n]))
+}
+
+func TestFS_ReadAtBuf_ContextCanceled(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Size: 1024})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+			flusher, _ := w.(http.Flusher)
+			w.Write([]byte{0})
+			if flusher != nil {
+				flusher.Flush()
+			}
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	p := make([]byte, 100)
+	n, err := client.AllocFS().ReadAtBuf(ctx, alloc, "foo", p, 0, nil)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.Equal(t, 0, n)
+}
+
+func TestFS_HeadTail_SmallFileOverlapDeduped(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("one\ntwo\nthree\n")
+	ts := fsLastLineServer(t, content)
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	head, tail, err := client.AllocFS().HeadTail(alloc, "foo", 2, 2, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"one", "two"}, head)
+	require.Equal(t, []string{"three"}, tail)
+}
+
+func TestFS_HeadTail_MediumFileNoOverlap(t *testing.T) {
+	t.Parallel()
+
+	var lines []string
+	for i := 0; i < 50; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	content := []byte(strings.Join(lines, "\n") + "\n")
+	ts := fsLastLineServer(t, content)
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	head, tail, err := client.AllocFS().HeadTail(alloc, "foo", 3, 3, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"line 0", "line 1", "line 2"}, head)
+	require.Equal(t, []string{"line 47", "line 48", "line 49"}, tail)
+}
+
+func TestFS_HeadTail_LargeFileWindowed(t *testing.T) {
+	t.Parallel()
+
+	middle := strings.Repeat("x", 3*lastLineMaxWindow)
+	content := []byte("first\nsecond\n" + middle + "\nsecond to last\nlast\n")
+	ts := fsLastLineServer(t, content)
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	head, tail, err := client.AllocFS().HeadTail(alloc, "foo", 2, 2, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"first", "second"}, head)
+	require.Equal(t, []string{"second to last", "last"}, tail)
+}
+
+func TestFS_URLRewriter(t *testing.T) {
+	t.Parallel()
+
+	var gotHost string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/") {
+			b, _ := json.Marshal(&AllocFileInfo{Size: 3})
+			w.Write(b)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	config := DefaultConfig()
+	config.Address = "http://rewrite-me.invalid"
+	config.URLRewriter = func(u *url.URL) {
+		u.Host = tsURL.Host
+	}
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	info, _, err := client.AllocFS().Stat(alloc, "foo", nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), info.Size)
+	require.Equal(t, tsURL.Host, gotHost)
+}
+
+func TestFS_ParallelCat(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Size: int64(len(content))})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+			offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+			limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+			end := offset + limit
+			if end > int64(len(content)) {
+				end = int64(len(content))
+			}
+			w.Write(content[offset:end])
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	serial, err := client.AllocFS().Cat(alloc, "foo", nil)
+	require.NoError(t, err)
+	serialBytes, err := io.ReadAll(serial)
+	require.NoError(t, err)
+	serial.Close()
+
+	parallel, err := client.AllocFS().ParallelCat(alloc, "foo", 4, nil)
+	require.NoError(t, err)
+	parallelBytes, err := io.ReadAll(parallel)
+	require.NoError(t, err)
+	parallel.Close()
+
+	require.Equal(t, serialBytes, parallelBytes)
+}
+
+func TestFS_CountLines(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		content string
+		want    int64
+	}{
+		{name: "trailing newline", content: "a\nb\nc\n", want: 3},
+		{name: "no trailing newline", content: "a\nb\nc", want: 2},
+		{name: "empty file", content: "", want: 0},
+		{name: "single line no newline", content: "a", want: 0},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			content := []byte(c.content)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+					b, _ := json.Marshal(&AllocFileInfo{Size: int64(len(content))})
+					w.Write(b)
+				case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+					offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+					limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+					end := offset + limit
+					if end > int64(len(content)) {
+						end = int64(len(content))
+					}
+					w.Write(content[offset:end])
+				case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+					w.Write(content)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer ts.Close()
+
+			config := DefaultConfig()
+			config.Address = ts.URL
+			client, err := NewClient(config)
+			require.NoError(t, err)
+
+			alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+			n, err := client.AllocFS().CountLines(alloc, "foo", nil)
+			require.NoError(t, err)
+			require.Equal(t, c.want, n)
+
+			if len(content) > 0 {
+				parallelN, err := client.AllocFS().ParallelCountLines(alloc, "foo", 3, nil)
+				require.NoError(t, err)
+				require.Equal(t, c.want, parallelN)
+			}
+		})
+	}
+}
+
+func TestFS_ParallelCat_PartFailure(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("0123456789abcdef")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Size: int64(len(content))})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+			offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+			if offset > 0 {
+				http.Error(w, "boom", http.StatusInternalServerError)
+				return
+			}
+			limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+			end := offset + limit
+			if end > int64(len(content)) {
+				end = int64(len(content))
+			}
+			w.Write(content[offset:end])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	_, err = client.AllocFS().ParallelCat(alloc, "foo", 4, nil)
+	require.Error(t, err)
+}
+
+func fsTreeServer(t *testing.T, files map[string]string) *httptest.Server {
+	t.Helper()
+
+	dirs := map[string][]*AllocFileInfo{}
+	for p, content := range files {
+		dir := gopath.Dir(p)
+		dirs[dir] = append(dirs[dir], &AllocFileInfo{Name: gopath.Base(p), Size: int64(len(content))})
+	}
+	dirs["/"] = append(dirs["/"], &AllocFileInfo{Name: "sub", IsDir: true})
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			p := r.URL.Query().Get("path")
+			b, _ := json.Marshal(dirs[p])
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			p := r.URL.Query().Get("path")
+			w.Write([]byte(files[p]))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestFS_DownloadTree(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"/a.log":     "hello",
+		"/sub/b.log": "world!",
+	}
+	ts := fsTreeServer(t, files)
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	got := map[string]string{}
+	err = client.AllocFS().DownloadTree(alloc, "/", 0, func(path string, r io.Reader) error {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		got[path] = string(b)
+		return nil
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, files, got)
+}
+
+// TestFS_DownloadTree_BudgetExceededMidTree simulates a file growing
+// between the pre-sum pass and the actual download pass, which is the
+// realistic way a budget that passed pre-summing can still be tripped
+// mid-tree.
+func TestFS_DownloadTree_BudgetExceededMidTree(t *testing.T) {
+	t.Parallel()
+
+	var subListCalls int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			switch r.URL.Query().Get("path") {
+			case "/":
+				b, _ := json.Marshal([]*AllocFileInfo{
+					{Name: "a.log", Size: 5},
+					{Name: "sub", IsDir: true},
+				})
+				w.Write(b)
+			case "/sub":
+				size := int64(5)
+				if atomic.AddInt32(&subListCalls, 1) > 1 {
+					size = 50
+				}
+				b, _ := json.Marshal([]*AllocFileInfo{{Name: "b.log", Size: size}})
+				w.Write(b)
+			default:
+				w.Write([]byte("[]"))
+			}
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			switch r.URL.Query().Get("path") {
+			case "/a.log":
+				w.Write([]byte("hello"))
+			case "/sub/b.log":
+				w.Write([]byte(strings.Repeat("w", 50)))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	var downloadedCount int
+	err = client.AllocFS().DownloadTree(alloc, "/", 10, func(path string, r io.Reader) error {
+		downloadedCount++
+		_, err := io.ReadAll(r)
+		return err
+	}, nil)
+	require.Error(t, err)
+	budgetErr, ok := err.(*ErrDownloadBudgetExceeded)
+	require.True(t, ok)
+	require.Equal(t, "/sub/b.log", budgetErr.Path)
+	require.Equal(t, 1, downloadedCount)
+}
+
+func TestFS_DownloadTree_PreSumRejectsBeforeDownload(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"/a.log":     strings.Repeat("x", 50),
+		"/sub/b.log": strings.Repeat("y", 50),
+	}
+	ts := fsTreeServer(t, files)
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	var downloadedCount int
+	err = client.AllocFS().DownloadTree(alloc, "/", 20, func(path string, r io.Reader) error {
+		downloadedCount++
+		_, err := io.ReadAll(r)
+		return err
+	}, nil)
+	require.Error(t, err)
+	_, ok := err.(*ErrDownloadBudgetExceeded)
+	require.True(t, ok)
+	require.Equal(t, 0, downloadedCount)
+}
+
+func TestFS_StreamDelta_Append(t *testing.T) {
+	t.Parallel()
+
+	var gotOffset string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			http.NotFound(w, r)
+			return
+		}
+		gotOffset = r.URL.Query().Get("offset")
+		b, _ := json.Marshal(&StreamFrame{Data: []byte("new stuff"), Offset: 100})
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	prev := &AllocFileInfo{Size: 50}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, _, truncated := client.AllocFS().StreamDelta(alloc, "foo", prev, cancel, nil)
+	frame := <-frames
+	require.False(t, truncated)
+	require.Equal(t, "50", gotOffset)
+	require.Equal(t, []byte("new stuff"), frame.Data)
+}
+
+func TestFS_StreamDelta_Truncated(t *testing.T) {
+	t.Parallel()
+
+	var gotOffset string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Size: 10})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/"):
+			gotOffset = r.URL.Query().Get("offset")
+			b, _ := json.Marshal(&StreamFrame{Data: []byte("from scratch"), Offset: 0})
+			w.Write(b)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	prev := &AllocFileInfo{Size: 50}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, _, truncated := client.AllocFS().StreamDelta(alloc, "foo", prev, cancel, nil)
+	frame := <-frames
+	require.True(t, truncated)
+	require.Equal(t, "0", gotOffset)
+	require.Equal(t, []byte("from scratch"), frame.Data)
+}
+
+type recordingObserver struct {
+	mu   sync.Mutex
+	obs  []string
+	errs []bool
+}
+
+func (r *recordingObserver) ObserveRequest(op string, dur time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.obs = append(r.obs, op)
+	r.errs = append(r.errs, err != nil)
+}
+
+func TestFS_MetricsObserver(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Size: 1})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	obs := &recordingObserver{}
+	config := DefaultConfig()
+	config.Address = ts.URL
+	config.MetricsObserver = obs
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	_, _, err = client.AllocFS().Stat(alloc, "foo", nil)
+	require.NoError(t, err)
+
+	_, _, err = client.AllocFS().List(alloc, "/", nil)
+	require.Error(t, err)
+
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+	require.Equal(t, []string{"Stat", "List"}, obs.obs)
+	require.Equal(t, []bool{false, true}, obs.errs)
+}
+
+func TestFS_ReadAt_NegativeArgs(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/") {
+			w.Write([]byte("ok"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	cases := []struct {
+		name    string
+		offset  int64
+		limit   int64
+		wantErr bool
+	}{
+		{name: "negative offset", offset: -1, limit: 10, wantErr: true},
+		{name: "negative limit", offset: 0, limit: -1, wantErr: true},
+		{name: "zero limit means to EOF", offset: 0, limit: 0, wantErr: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := client.AllocFS().ReadAt(alloc, "foo", tc.offset, tc.limit, nil)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			r.Close()
+		})
+	}
+}
+
+func TestFS_Cat_WriteTo(t *testing.T) {
+	t.Parallel()
+
+	content := "hello from the allocation log\n" + strings.Repeat("x", 8192)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			w.Write([]byte(content))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	r, err := client.AllocFS().Cat(alloc, "alloc/logs/task.stdout.0", nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	wt, ok := r.(io.WriterTo)
+	require.True(t, ok, "Cat result should implement io.WriterTo")
+
+	var buf bytes.Buffer
+	n, err := wt.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), n)
+	require.Equal(t, content, buf.String())
+}
+
+// TestFS_PathEscaping_List verifies that filenames containing characters
+// that are significant in a URL query string (space, '+', '#', and
+// unicode) survive a List call unescaped, since path is transmitted as a
+// normal query parameter which url.Values already encodes and decodes
+// correctly.
+func TestFS_PathEscaping_List(t *testing.T) {
+	t.Parallel()
+
+	const trickyName = "a b+c#dé.log"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/") {
+			path := r.URL.Query().Get("path")
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]*AllocFileInfo{
+				{Name: path, IsDir: false, Size: 5},
+			})
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	entries, _, err := client.AllocFS().List(alloc, "/"+trickyName, nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "/"+trickyName, entries[0].Name)
+}
+
+// TestFS_PathEscaping_Cat verifies the same round-trip for Cat, where the
+// stub echoes the decoded path back as the file's content so the test can
+// assert the server observed the exact, unescaped filename.
+func TestFS_PathEscaping_Cat(t *testing.T) {
+	t.Parallel()
+
+	const trickyName = "a b+c#dé.log"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			w.Write([]byte(r.URL.Query().Get("path")))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	r, err := client.AllocFS().Cat(alloc, "/"+trickyName, nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "/"+trickyName, string(got))
+}
+
+func TestFS_Snapshot_SnapshotExtract(t *testing.T) {
+	t.Parallel()
+
+	ts := fsTreeServer(t, map[string]string{
+		"/a.txt":     "hello",
+		"/sub/b.txt": "world",
+	})
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	dir := t.TempDir()
+	summary, err := client.AllocFS().SnapshotExtract(alloc, dir, nil)
+	require.NoError(t, err)
+	require.Len(t, summary.Files, 2)
+	require.Equal(t, int64(10), summary.TotalBytes)
+
+	got, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(got))
+
+	got, err = os.ReadFile(filepath.Join(dir, "sub", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "world", string(got))
+}
+
+func TestFS_ExtractTar_RejectsTarSlip(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:     "../../etc/passwd",
+		Typeflag: tar.TypeReg,
+		Size:     4,
+		Mode:     0644,
+	}))
+	_, err := tw.Write([]byte("evil"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	dir := t.TempDir()
+	summary, err := extractTar(&buf, dir)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "escapes destination directory")
+	require.Empty(t, summary.Files)
+
+	_, err = os.Stat(filepath.Join(filepath.Dir(dir), "etc", "passwd"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestFS_StreamFollow_Truncation(t *testing.T) {
+	t.Parallel()
+
+	var conns int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// GetNodeClientWithTimeout probes the node before the actual stream
+		// request; ignore anything that isn't the stream request itself.
+		if r.URL.Query().Get("path") == "" {
+			return
+		}
+
+		n := atomic.AddInt32(&conns, 1)
+		offset := r.URL.Query().Get("offset")
+
+		enc := json.NewEncoder(w)
+		if n == 1 {
+			require.Equal(t, "10", offset)
+			require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("old"), Offset: 10}))
+			require.NoError(t, enc.Encode(&StreamFrame{FileEvent: FileEventTruncated}))
+			return
+		}
+
+		require.Equal(t, "0", offset)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("new"), Offset: 0}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	var truncations int32
+	frames, errCh := client.AllocFS().StreamFollow(alloc, "log", 10, func() {
+		atomic.AddInt32(&truncations, 1)
+	}, false, cancel, nil)
+
+	var got []byte
+READ:
+	for {
+		select {
+		case f, ok := <-frames:
+			if !ok {
+				break READ
+			}
+			got = append(got, f.Data...)
+		case err := <-errCh:
+			t.Fatalf("unexpected error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for frames")
+		}
+	}
+
+	require.Equal(t, "oldnew", string(got))
+	require.Equal(t, int32(1), atomic.LoadInt32(&truncations))
+}
+
+func TestFS_StreamFollowWithDiagnostics_LogsReconnectOnTruncation(t *testing.T) {
+	t.Parallel()
+
+	var conns int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("path") == "" {
+			return
+		}
+
+		n := atomic.AddInt32(&conns, 1)
+		enc := json.NewEncoder(w)
+		if n == 1 {
+			require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("old"), Offset: 10}))
+			require.NoError(t, enc.Encode(&StreamFrame{FileEvent: FileEventTruncated}))
+			return
+		}
+
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("new"), Offset: 0}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	var diag bytes.Buffer
+	var diagMu sync.Mutex
+	frames, errCh := client.AllocFS().StreamFollowWithDiagnostics(alloc, "log", 10, false,
+		StreamConfig{Diagnostics: &syncWriter{mu: &diagMu, w: &diag}}, cancel, nil)
+
+	got, err := drainStreamFollow(t, frames, errCh)
+	require.NoError(t, err)
+	require.Equal(t, "oldnew", string(got))
+
+	diagMu.Lock()
+	output := diag.String()
+	diagMu.Unlock()
+	require.Contains(t, output, "truncated")
+	require.Contains(t, output, "reconnecting")
+}
+
+// syncWriter serializes writes from concurrent goroutines onto an
+// underlying io.Writer, for tests that capture StreamConfig.Diagnostics
+// output while frames are still being produced on another goroutine.
+type syncWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+func TestFS_StreamLines_DiagnosticsLogsDroppedLines(t *testing.T) {
+	t.Parallel()
+
+	const total = 30
+	srv := backpressureTestServer(t, total)
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	var diag bytes.Buffer
+	var diagMu sync.Mutex
+	lines, errCh := client.AllocFS().StreamLines(alloc, "log", OriginStart, 0,
+		StreamConfig{
+			BackpressurePolicy: StreamBackpressureDropNewest,
+			Diagnostics:        &syncWriter{mu: &diagMu, w: &diag},
+		}, nil, cancel, nil)
+
+	time.Sleep(100 * time.Millisecond)
+	_ = collectStreamLines(t, lines, errCh)
+
+	diagMu.Lock()
+	output := diag.String()
+	diagMu.Unlock()
+	require.Contains(t, output, "dropped newest line")
+}
+
+// drainStreamFollow reads frames and errCh until frames closes, then gives
+// errCh a final chance to deliver an error that arrived alongside closure.
+func drainStreamFollow(t *testing.T, frames <-chan *StreamFrame, errCh <-chan error) ([]byte, error) {
+	t.Helper()
+
+	var got []byte
+	var gotErr error
+	open := true
+	for open {
+		select {
+		case f, ok := <-frames:
+			if !ok {
+				open = false
+				continue
+			}
+			got = append(got, f.Data...)
+		case err := <-errCh:
+			gotErr = err
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for frames")
+		}
+	}
+
+	if gotErr == nil {
+		select {
+		case gotErr = <-errCh:
+		case <-time.After(time.Second):
+		}
+	}
+
+	return got, gotErr
+}
+
+func TestFS_StreamFollow_DeletionTerminates(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("path") == "" {
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("before"), Offset: 0}))
+		require.NoError(t, enc.Encode(&StreamFrame{FileEvent: FileEventDeleted}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, errCh := client.AllocFS().StreamFollow(alloc, "log", 0, nil, false, cancel, nil)
+	got, gotErr := drainStreamFollow(t, frames, errCh)
+
+	require.Equal(t, "before", string(got))
+	require.True(t, errors.Is(gotErr, ErrFileDeleted))
+}
+
+func TestFS_StreamFollow_DeletionThenRecreateResumes(t *testing.T) {
+	t.Parallel()
+
+	var streamConns int32
+	var statAttempts int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/") {
+			n := atomic.AddInt32(&statAttempts, 1)
+			if n < 2 {
+				http.NotFound(w, r)
+				return
+			}
+			b, _ := json.Marshal(&AllocFileInfo{Size: 3})
+			w.Write(b)
+			return
+		}
+
+		// GetNodeClientWithTimeout probes the node before the actual stream
+		// request; ignore anything that isn't the stream request itself.
+		if r.URL.Query().Get("path") == "" {
+			return
+		}
+
+		n := atomic.AddInt32(&streamConns, 1)
+		enc := json.NewEncoder(w)
+		if n == 1 {
+			require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("old"), Offset: 0}))
+			require.NoError(t, enc.Encode(&StreamFrame{FileEvent: FileEventDeleted}))
+			return
+		}
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("new"), Offset: 0}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, errCh := client.AllocFS().StreamFollow(alloc, "log", 0, nil, true, cancel, nil)
+	got, gotErr := drainStreamFollow(t, frames, errCh)
+
+	require.NoError(t, gotErr)
+	require.Equal(t, "oldnew", string(got))
+}
+
+func TestJobFS_CatMany_MixOfReachableAndUnreachable(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		allocID := strings.TrimPrefix(r.URL.Path, "/v1/client/fs/cat/")
+		if allocID == "unreachable" {
+			http.Error(w, "no route to node", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("log from " + allocID))
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	allocs := []*Allocation{
+		{ID: "reachable-1", NodeID: "unknown"},
+		{ID: "unreachable", NodeID: "unknown"},
+		{ID: "reachable-2", NodeID: "unknown"},
+	}
+
+	results := client.JobFS().CatMany(allocs, "foo", nil)
+	require.Len(t, results, 3)
+
+	require.Equal(t, "reachable-1", results[0].AllocID)
+	require.NoError(t, results[0].Err)
+	require.Equal(t, "log from reachable-1", string(results[0].Content))
+
+	require.Equal(t, "unreachable", results[1].AllocID)
+	require.Error(t, results[1].Err)
+
+	require.Equal(t, "reachable-2", results[2].AllocID)
+	require.NoError(t, results[2].Err)
+	require.Equal(t, "log from reachable-2", string(results[2].Content))
+}
+
+func TestJobFS_TailAll_MergesInterleavedLinesAndReportsFailures(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/logs/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		allocID := strings.TrimPrefix(r.URL.Path, "/v1/client/fs/logs/")
+		if allocID == "unreachable" {
+			http.Error(w, "no route to node", http.StatusInternalServerError)
+			return
+		}
+
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte(allocID + "-line1\n")}))
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte(allocID + "-line2\n")}))
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	allocs := []*Allocation{
+		{ID: "alloc-1", NodeID: "unknown"},
+		{ID: "unreachable", NodeID: "unknown"},
+		{ID: "alloc-2", NodeID: "unknown"},
+	}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	out, errCh := client.JobFS().TailAll(allocs, "task", "stdout", 0, false, cancel, nil)
+
+	byAlloc := map[string][]string{}
+	for line := range out {
+		byAlloc[line.AllocID] = append(byAlloc[line.AllocID], line.Line)
+	}
+
+	require.Equal(t, []string{"alloc-1-line1", "alloc-1-line2"}, byAlloc["alloc-1"])
+	require.Equal(t, []string{"alloc-2-line1", "alloc-2-line2"}, byAlloc["alloc-2"])
+	require.Empty(t, byAlloc["unreachable"])
+
+	select {
+	case err := <-errCh:
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unreachable")
+	default:
+		t.Fatalf("expected an error for the unreachable allocation")
+	}
+}
+
+func TestFS_ParseLogFileName(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		wantTask  string
+		wantType  string
+		wantIndex int
+		wantOK    bool
+	}{
+		{name: "redis.stdout.0", wantTask: "redis", wantType: "stdout", wantIndex: 0, wantOK: true},
+		{name: "web.stderr.12", wantTask: "web", wantType: "stderr", wantIndex: 12, wantOK: true},
+		{name: "not-a-log-file.txt", wantOK: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			task, logType, index, ok := ParseLogFileName(tc.name)
+			require.Equal(t, tc.wantOK, ok)
+			if !tc.wantOK {
+				return
+			}
+			require.Equal(t, tc.wantTask, task)
+			require.Equal(t, tc.wantType, logType)
+			require.Equal(t, tc.wantIndex, index)
+		})
+	}
+}
+
+func TestFS_ResolveLogOffset(t *testing.T) {
+	t.Parallel()
+
+	// Given out of rotation order, to verify ResolveLogOffset sorts by
+	// index itself rather than trusting caller ordering.
+	entries := []*AllocFileInfo{
+		{Name: "redis.stdout.2", Size: 5},
+		{Name: "redis.stdout.0", Size: 10},
+		{Name: "redis.stdout.1", Size: 20},
+	}
+
+	cases := []struct {
+		name       string
+		offset     int64
+		wantFile   string
+		wantOffset int64
+		wantErr    bool
+	}{
+		{name: "start of first file", offset: 0, wantFile: "redis.stdout.0", wantOffset: 0},
+		{name: "middle of first file", offset: 9, wantFile: "redis.stdout.0", wantOffset: 9},
+		{name: "start of second file", offset: 10, wantFile: "redis.stdout.1", wantOffset: 0},
+		{name: "middle of second file", offset: 25, wantFile: "redis.stdout.1", wantOffset: 15},
+		{name: "start of third file", offset: 30, wantFile: "redis.stdout.2", wantOffset: 0},
+		{name: "last byte of third file", offset: 34, wantFile: "redis.stdout.2", wantOffset: 4},
+		{name: "exactly at end", offset: 35, wantErr: true},
+		{name: "past the end", offset: 100, wantErr: true},
+		{name: "negative", offset: -1, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ResolveLogOffset(entries, tc.offset)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.wantFile, got.File)
+			require.Equal(t, tc.wantOffset, got.Offset)
+		})
+	}
+}
+
+func TestFS_AllLogs(t *testing.T) {
+	t.Parallel()
+
+	entries := []*AllocFileInfo{
+		{Name: "redis.stdout.0", Size: 10},
+		{Name: "redis.stderr.0", Size: 20},
+		{Name: "web.stdout.0", Size: 30},
+		{Name: "core", Size: 1},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/") {
+			require.Equal(t, "alloc/logs", r.URL.Query().Get("path"))
+			b, _ := json.Marshal(entries)
+			w.Write(b)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	grouped, err := client.AllocFS().AllLogs(alloc, nil)
+	require.NoError(t, err)
+	require.Len(t, grouped["redis"], 2)
+	require.Len(t, grouped["web"], 1)
+	require.Len(t, grouped[unrecognizedLogsTask], 1)
+	require.Equal(t, "core", grouped[unrecognizedLogsTask][0].Name)
+}
+
+func TestFS_TasksWithLogs(t *testing.T) {
+	t.Parallel()
+
+	entries := []*AllocFileInfo{
+		{Name: "redis.stdout.0", Size: 10},
+		{Name: "redis.stderr.0", Size: 20},
+		{Name: "web.stdout.0", Size: 30},
+		{Name: "core", Size: 1},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/") {
+			b, _ := json.Marshal(entries)
+			w.Write(b)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	tasks, err := client.AllocFS().TasksWithLogs(alloc, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"redis", "web"}, tasks)
+}
+
+func TestFS_RequireNodeVersion_FailsFastOnOldNode(t *testing.T) {
+	t.Parallel()
+
+	var infoCalls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/node/") {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&infoCalls, 1)
+		node := &Node{ID: "node1", Attributes: map[string]string{"nomad.version": "1.5.0"}}
+		b, _ := json.Marshal(node)
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "node1"}
+	fs := client.AllocFS()
+
+	err = fs.RequireNodeVersion(alloc, "plain-mode logs", "1.6.0", nil)
+	var tooOld *ErrNodeVersionTooOld
+	require.True(t, errors.As(err, &tooOld))
+	require.Equal(t, "plain-mode logs", tooOld.Feature)
+	require.Equal(t, "1.6.0", tooOld.RequiredVersion)
+	require.Equal(t, "1.5.0", tooOld.NodeVersion)
+
+	// A second call against the same node must hit the cache, not Nodes.Info
+	// again.
+	err = fs.RequireNodeVersion(alloc, "plain-mode logs", "1.6.0", nil)
+	require.Error(t, err)
+	require.EqualValues(t, 1, atomic.LoadInt32(&infoCalls))
+}
+
+func TestFS_RequireNodeVersion_OKOnNewEnoughNode(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		node := &Node{ID: "node1", Attributes: map[string]string{"nomad.version": "1.7.2"}}
+		b, _ := json.Marshal(node)
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "node1"}
+
+	err = client.AllocFS().RequireNodeVersion(alloc, "plain-mode logs", "1.6.0", nil)
+	require.NoError(t, err)
+}
+
+func TestFS_RequireNodeVersion_CacheExpiresAfterTTL(t *testing.T) {
+	t.Parallel()
+
+	var infoCalls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&infoCalls, 1)
+		node := &Node{ID: "node1", Attributes: map[string]string{"nomad.version": "1.7.2"}}
+		b, _ := json.Marshal(node)
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "node1"}
+	fs := client.AllocFS()
+	clk := newManualClock()
+	fs.setClock(clk)
+
+	require.NoError(t, fs.RequireNodeVersion(alloc, "plain-mode logs", "1.6.0", nil))
+	require.EqualValues(t, 1, atomic.LoadInt32(&infoCalls))
+
+	// Still within the TTL: cached, no new Info call.
+	require.NoError(t, fs.RequireNodeVersion(alloc, "plain-mode logs", "1.6.0", nil))
+	require.EqualValues(t, 1, atomic.LoadInt32(&infoCalls))
+
+	// Past the TTL: the cache entry must be treated as stale.
+	clk.advance(nodeVersionCacheTTL + time.Second)
+	require.NoError(t, fs.RequireNodeVersion(alloc, "plain-mode logs", "1.6.0", nil))
+	require.EqualValues(t, 2, atomic.LoadInt32(&infoCalls))
+}
+
+func TestFS_InvalidateNodeVersion(t *testing.T) {
+	t.Parallel()
+
+	var infoCalls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&infoCalls, 1)
+		node := &Node{ID: "node1", Attributes: map[string]string{"nomad.version": "1.7.2"}}
+		b, _ := json.Marshal(node)
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "node1"}
+	fs := client.AllocFS()
+
+	require.NoError(t, fs.RequireNodeVersion(alloc, "plain-mode logs", "1.6.0", nil))
+	require.EqualValues(t, 1, atomic.LoadInt32(&infoCalls))
+
+	// Without invalidating, the cache entry is reused.
+	require.NoError(t, fs.RequireNodeVersion(alloc, "plain-mode logs", "1.6.0", nil))
+	require.EqualValues(t, 1, atomic.LoadInt32(&infoCalls))
+
+	fs.InvalidateNodeVersion(alloc.NodeID)
+
+	require.NoError(t, fs.RequireNodeVersion(alloc, "plain-mode logs", "1.6.0", nil))
+	require.EqualValues(t, 2, atomic.LoadInt32(&infoCalls))
+}
+
+func TestFS_OpenLog_SmallFileStartsFromBeginning(t *testing.T) {
+	t.Parallel()
+
+	entries := []*AllocFileInfo{
+		{Name: "redis.stdout.0", Size: 10},
+	}
+
+	var gotOrigin, gotOffset, gotFollow string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			b, _ := json.Marshal(entries)
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/logs/"):
+			gotOrigin = r.URL.Query().Get("origin")
+			gotOffset = r.URL.Query().Get("offset")
+			gotFollow = r.URL.Query().Get("follow")
+			b, _ := json.Marshal(&StreamFrame{Data: []byte("hello")})
+			w.Write(b)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, errCh := client.AllocFS().OpenLog(alloc, "redis", "stdout", 10, cancel, nil)
+	select {
+	case f := <-frames:
+		require.Equal(t, "hello", string(f.Data))
+	case err := <-errCh:
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	require.Equal(t, OriginStart, gotOrigin)
+	require.Equal(t, "0", gotOffset)
+	require.Equal(t, "true", gotFollow)
+}
+
+func TestFS_OpenLog_LargeFileStartsFromTail(t *testing.T) {
+	t.Parallel()
+
+	entries := []*AllocFileInfo{
+		{Name: "redis.stdout.0", Size: openLogTailThreshold + 1},
+	}
+
+	var gotOrigin, gotOffset string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			b, _ := json.Marshal(entries)
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/logs/"):
+			gotOrigin = r.URL.Query().Get("origin")
+			gotOffset = r.URL.Query().Get("offset")
+			b, _ := json.Marshal(&StreamFrame{Data: []byte("tail")})
+			w.Write(b)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, errCh := client.AllocFS().OpenLog(alloc, "redis", "stdout", 10, cancel, nil)
+	select {
+	case f := <-frames:
+		require.Equal(t, "tail", string(f.Data))
+	case err := <-errCh:
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	require.Equal(t, OriginEnd, gotOrigin)
+	require.Equal(t, strconv.FormatInt(10*tailBytesPerLineEstimate, 10), gotOffset)
+}
+
+func TestFS_StreamWithKeepalive(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{}))
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("hello")}))
+		require.NoError(t, enc.Encode(&StreamFrame{}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	var heartbeats int32
+	frames, errCh := client.AllocFS().StreamWithKeepalive(alloc, "log", OriginStart, 0, func() {
+		atomic.AddInt32(&heartbeats, 1)
+	}, cancel, nil)
+
+	var got []byte
+READ:
+	for {
+		select {
+		case f, ok := <-frames:
+			if !ok {
+				break READ
+			}
+			got = append(got, f.Data...)
+		case err := <-errCh:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	require.Equal(t, "hello", string(got))
+	require.Equal(t, int32(2), atomic.LoadInt32(&heartbeats))
+}
+
+func TestFS_StreamDecode_SplitAcrossFrames(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte(`{"a":1}` + "\n" + `{"b":`)}))
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("2}\n")}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	values, errCh := client.AllocFS().StreamDecode(alloc, "log", OriginStart, 0,
+		func(line []byte) (interface{}, error) {
+			var rec map[string]int
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return nil, err
+			}
+			return rec, nil
+		}, cancel, nil)
+
+	var got []map[string]int
+READ:
+	for {
+		select {
+		case v, ok := <-values:
+			if !ok {
+				break READ
+			}
+			got = append(got, v.(map[string]int))
+		case err := <-errCh:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	require.Equal(t, []map[string]int{{"a": 1}, {"b": 2}}, got)
+}
+
+func TestFS_ListSecrets_ReadSecret_Redaction(t *testing.T) {
+	t.Parallel()
+
+	const secretContent = "super-secret-value"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			path := r.URL.Query().Get("path")
+			if path == "" {
+				return
+			}
+			require.Equal(t, "web/secrets", path)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]*AllocFileInfo{
+				{Name: "token", IsDir: false, Size: int64(len(secretContent))},
+			})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			path := r.URL.Query().Get("path")
+			require.Equal(t, "web/secrets/token", path)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&AllocFileInfo{Name: "token", IsDir: false, Size: int64(len(secretContent))})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			path := r.URL.Query().Get("path")
+			require.Equal(t, "web/secrets/token", path)
+			w.Write([]byte(secretContent))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	entries, _, err := client.AllocFS().ListSecrets(alloc, "web", nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "token", entries[0].Name)
+	require.Equal(t, int64(len(secretContent)), entries[0].Size)
+
+	redacted, err := client.AllocFS().ReadSecret(alloc, "web", "token", true, nil)
+	require.NoError(t, err)
+	require.Equal(t, "token", redacted.Name)
+	require.Nil(t, redacted.Content)
+
+	full, err := client.AllocFS().ReadSecret(alloc, "web", "token", false, nil)
+	require.NoError(t, err)
+	require.Equal(t, "token", full.Name)
+	require.Equal(t, secretContent, string(full.Content))
+}
+
+func collectStreamLines(t *testing.T, lines <-chan string, errCh <-chan error) []string {
+	t.Helper()
+
+	var got []string
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return got
+			}
+			got = append(got, line)
+		case err := <-errCh:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestFS_StreamLines_NodeHonorsLineDelimited(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		require.Equal(t, "true", r.URL.Query().Get("line_delimited"))
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("one\n")}))
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("two\n")}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	var boundaries []bool
+	lines, errCh := client.AllocFS().StreamLines(alloc, "log", OriginStart, 0,
+		StreamConfig{RequestLineDelimited: true},
+		func(endsOnNewline bool) { boundaries = append(boundaries, endsOnNewline) },
+		cancel, nil)
+
+	got := collectStreamLines(t, lines, errCh)
+	require.Equal(t, []string{"one", "two"}, got)
+	require.Equal(t, []bool{true, true}, boundaries)
+}
+
+func TestFS_StreamLines_NodeIgnoresLineDelimited(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		// Simulate an older node that doesn't recognize line_delimited and
+		// just sends frames split mid-line.
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("on")}))
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("e\ntw")}))
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("o\n")}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	var boundaries []bool
+	lines, errCh := client.AllocFS().StreamLines(alloc, "log", OriginStart, 0,
+		StreamConfig{RequestLineDelimited: true},
+		func(endsOnNewline bool) { boundaries = append(boundaries, endsOnNewline) },
+		cancel, nil)
+
+	got := collectStreamLines(t, lines, errCh)
+	require.Equal(t, []string{"one", "two"}, got)
+	require.Equal(t, []bool{false, false, true}, boundaries)
+}
+
+// TestFS_CatConsistent_DetectsChangeBetweenStatAndCat simulates log
+// rotation: the file grows between the first Stat CatConsistent issues
+// and its own re-Stat, so ErrFileChanged must be returned instead of a
+// reader over what could be a torn read.
+func TestFS_CatConsistent_DetectsChangeBetweenStatAndCat(t *testing.T) {
+	t.Parallel()
+
+	var statCount int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			n := atomic.AddInt32(&statCount, 1)
+			w.Header().Set("Content-Type", "application/json")
+			size := int64(100)
+			if n > 1 {
+				size = 200
+			}
+			json.NewEncoder(w).Encode(&AllocFileInfo{Name: "task.stdout.0", Size: size})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			w.Write([]byte(strings.Repeat("x", 100)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	r, before, after, err := client.AllocFS().CatConsistent(alloc, "alloc/logs/task.stdout.0", nil)
+	require.Nil(t, r)
+	require.True(t, errors.Is(err, ErrFileChanged))
+	require.Equal(t, int64(100), before.Size)
+	require.Equal(t, int64(200), after.Size)
+}
+
+// TestFS_CatConsistent_NoChangeReturnsReader verifies the common case
+// where the file is unchanged between the two stats: CatConsistent
+// should hand back a normal, fully readable Cat reader.
+func TestFS_CatConsistent_NoChangeReturnsReader(t *testing.T) {
+	t.Parallel()
+
+	content := "steady state log line\n"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&AllocFileInfo{Name: "task.stdout.0", Size: int64(len(content))})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			w.Write([]byte(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	r, before, after, err := client.AllocFS().CatConsistent(alloc, "alloc/logs/task.stdout.0", nil)
+	require.NoError(t, err)
+	defer r.Close()
+	require.Equal(t, before.Size, after.Size)
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, content, string(got))
+}
+
+// TestFS_Lines_FiniteRead verifies that with follow=false, Lines yields
+// each reassembled line and then stops cleanly (no error) once the
+// node's stream ends.
+func TestFS_Lines_FiniteRead(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("one\ntwo\n")}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	var got []string
+	var yieldErr error
+	it := client.AllocFS().Lines(context.Background(), alloc, "log", false, nil)
+	it(func(line string, err error) bool {
+		if err != nil {
+			yieldErr = err
+			return false
+		}
+		got = append(got, line)
+		return true
+	})
+
+	require.NoError(t, yieldErr)
+	require.Equal(t, []string{"one", "two"}, got)
+}
+
+// TestFS_Lines_ContextCanceledWhileFollowing verifies that when follow
+// is true and ctx is canceled mid-stream, Lines stops and yields
+// ctx.Err() rather than hanging forever waiting for more lines.
+func TestFS_Lines_ContextCanceledWhileFollowing(t *testing.T) {
+	t.Parallel()
+
+	serverDone := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		for i := 0; ; i++ {
+			select {
+			case <-r.Context().Done():
+				close(serverDone)
+				return
+			default:
+			}
+			if err := enc.Encode(&StreamFrame{Data: []byte(fmt.Sprintf("one%d\n", i))}); err != nil {
+				close(serverDone)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var got []string
+	var yieldErr error
+	it := client.AllocFS().Lines(ctx, alloc, "log", true, nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		it(func(line string, err error) bool {
+			if err != nil {
+				yieldErr = err
+				return false
+			}
+			got = append(got, line)
+			if len(got) == 1 {
+				cancel()
+			}
+			return true
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Lines never returned after ctx cancellation")
+	}
+
+	require.True(t, len(got) >= 1, "expected at least one line before cancellation")
+	require.Equal(t, "one0", got[0])
+	require.True(t, errors.Is(yieldErr, context.Canceled))
+
+	select {
+	case <-serverDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server never observed the client disconnect")
+	}
+}
+
+type recordedSpan struct {
+	op    string
+	attrs map[string]string
+}
+
+type recordingTracer struct {
+	mu      sync.Mutex
+	started []recordedSpan
+	ended   []bool // whether the ended span's err was non-nil
+}
+
+func (rt *recordingTracer) StartSpan(op string, attrs map[string]string) SpanToken {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	token := len(rt.started)
+	rt.started = append(rt.started, recordedSpan{op: op, attrs: attrs})
+	return token
+}
+
+func (rt *recordingTracer) EndSpan(token SpanToken, err error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.ended = append(rt.ended, err != nil)
+}
+
+func TestFS_Tracer_SpansFireWithAttributes(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Size: 1})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	tracer := &recordingTracer{}
+	config := DefaultConfig()
+	config.Address = ts.URL
+	config.Tracer = tracer
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	_, _, err = client.AllocFS().Stat(alloc, "foo", nil)
+	require.NoError(t, err)
+
+	_, _, err = client.AllocFS().List(alloc, "/bar", nil)
+	require.Error(t, err)
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	require.Len(t, tracer.started, 2)
+	require.Equal(t, "Stat", tracer.started[0].op)
+	require.Equal(t, "unknown", tracer.started[0].attrs["node_id"])
+	require.Equal(t, "foo", tracer.started[0].attrs["path"])
+	require.Equal(t, "List", tracer.started[1].op)
+	require.Equal(t, "/bar", tracer.started[1].attrs["path"])
+	require.Equal(t, []bool{false, true}, tracer.ended)
+}
+
+func TestFS_Tracer_RedactSpanPaths(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := json.Marshal(&AllocFileInfo{Size: 1})
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	tracer := &recordingTracer{}
+	config := DefaultConfig()
+	config.Address = ts.URL
+	config.Tracer = tracer
+	config.RedactSpanPaths = true
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	_, _, err = client.AllocFS().Stat(alloc, "secret/path", nil)
+	require.NoError(t, err)
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	require.Len(t, tracer.started, 1)
+	require.Equal(t, "<redacted>", tracer.started[0].attrs["path"])
+}
+
+func TestFS_TailBytes_FileLargerThanN(t *testing.T) {
+	t.Parallel()
+
+	content := []byte(strings.Repeat("a", 100) + strings.Repeat("b", 20))
+	ts := fsLastLineServer(t, content)
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	tail, err := client.AllocFS().TailBytes(alloc, "foo", 20, nil)
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("b", 20), string(tail))
+}
+
+func TestFS_TailBytes_FileSmallerThanN(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("short content")
+	ts := fsLastLineServer(t, content)
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	tail, err := client.AllocFS().TailBytes(alloc, "foo", 1000, nil)
+	require.NoError(t, err)
+	require.Equal(t, content, tail)
+}
+
+func TestFS_TailBytes_EmptyFile(t *testing.T) {
+	t.Parallel()
+
+	ts := fsLastLineServer(t, []byte{})
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	tail, err := client.AllocFS().TailBytes(alloc, "foo", 10, nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte{}, tail)
+}
+
+func TestFS_PermissionDenied_Stat(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Permission denied: missing read-fs capability", http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	_, _, err = client.AllocFS().Stat(alloc, "foo", nil)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrPermissionDenied))
+	require.Contains(t, err.Error(), "read-fs")
+}
+
+func TestFS_PermissionDenied_NotMatchedOn404(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	_, _, err = client.AllocFS().Stat(alloc, "foo", nil)
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrPermissionDenied))
+}
+
+func TestFS_PermissionDenied_Cat(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	_, err = client.AllocFS().Cat(alloc, "foo", nil)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrPermissionDenied))
+}
+
+// TestFS_StreamReader_ConcatenatesFrames verifies that StreamReader's
+// output equals the concatenation of the underlying frames' Data, with
+// heartbeats discarded.
+func TestFS_StreamReader_ConcatenatesFrames(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{}))
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("hello "), Offset: 6}))
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("world"), Offset: 11}))
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	r, err := client.AllocFS().StreamReader(alloc, "log", OriginStart, 0, nil, nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(got))
+}
+
+// TestFS_StreamReader_TruncationReturnsError verifies that a truncation
+// frame mid-stream fails the Read with ErrStreamTruncated instead of
+// silently dropping the gap.
+func TestFS_StreamReader_TruncationReturnsError(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("partial"), Offset: 7}))
+		require.NoError(t, enc.Encode(&StreamFrame{FileEvent: FileEventTruncated}))
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	r, err := client.AllocFS().StreamReader(alloc, "log", OriginStart, 0, nil, nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = io.ReadAll(r)
+	require.True(t, errors.Is(err, ErrStreamTruncated))
+}
+
+// TestFS_StatMany_CompressesLargeBatches verifies that StatMany sends
+// its path list uncompressed below statManyGzipThreshold, and
+// gzip-compressed with Content-Encoding: gzip above it.
+func TestFS_StatMany_CompressesLargeBatches(t *testing.T) {
+	t.Parallel()
+
+	var gotEncoding string
+	var gotPaths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEncoding = r.Header.Get("Content-Encoding")
+
+		body := r.Body
+		if gotEncoding == "gzip" {
+			gz, err := gzip.NewReader(body)
+			require.NoError(t, err)
+			body = gz
+		}
+
+		var req statManyRequest
+		require.NoError(t, json.NewDecoder(body).Decode(&req))
+		gotPaths = req.Paths
+
+		out := make(map[string]*AllocFileInfo, len(req.Paths))
+		for _, p := range req.Paths {
+			out[p] = &AllocFileInfo{Name: p}
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(out))
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	smallPaths := []string{"a.log", "b.log"}
+	out, err := client.AllocFS().StatMany(alloc, smallPaths, nil)
+	require.NoError(t, err)
+	require.Empty(t, gotEncoding)
+	require.ElementsMatch(t, smallPaths, gotPaths)
+	require.Len(t, out, len(smallPaths))
+
+	var largePaths []string
+	for i := 0; i < 2000; i++ {
+		largePaths = append(largePaths, fmt.Sprintf("alloc/logs/task.stdout.%d", i))
+	}
+	out, err = client.AllocFS().StatMany(alloc, largePaths, nil)
+	require.NoError(t, err)
+	require.Equal(t, "gzip", gotEncoding)
+	require.ElementsMatch(t, largePaths, gotPaths)
+	require.Len(t, out, len(largePaths))
+}
+
+// TestFS_CompletedAllocWithRetainedFiles verifies that fs methods work
+// unchanged against a completed allocation whose files are still
+// retained on the node; completion status has no bearing on the
+// transport path, only garbage collection does.
+func TestFS_CompletedAllocWithRetainedFiles(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("retained output")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(content)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown", ClientStatus: AllocClientStatusComplete}
+	r, err := client.AllocFS().Cat(alloc, "alloc/logs/task.stdout.0", nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, content, got)
+}
+
+// TestFS_GCdAllocReturnsErrAllocationGCd verifies that a node response
+// for an allocation whose files have already been garbage collected is
+// surfaced as ErrAllocationGCd, distinguishable from a generic 404.
+func TestFS_GCdAllocReturnsErrAllocationGCd(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, fmt.Sprintf("Unknown allocation %q", "abc123"), http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown", ClientStatus: AllocClientStatusComplete}
+	_, err = client.AllocFS().Cat(alloc, "alloc/logs/task.stdout.0", nil)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrAllocationGCd))
+	require.False(t, errors.Is(err, ErrPermissionDenied))
+}
+
+// TestClient_WithContext_CancelStopsInFlightFSCalls verifies that
+// cancelling the base context set via Client.WithContext ends an
+// in-flight AllocFS call, even though the call itself was made with a nil
+// QueryOptions (no per-call context of its own).
+func TestClient_WithContext_CancelStopsInFlightFSCalls(t *testing.T) {
+	t.Parallel()
+
+	serverDone := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			return
+		}
+		flusher, _ := w.(http.Flusher)
+		for i := 0; i < 10000; i++ {
+			select {
+			case <-r.Context().Done():
+				close(serverDone)
+				return
+			default:
+			}
+			if _, err := w.Write([]byte("x")); err != nil {
+				close(serverDone)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	baseClient, err := NewClient(config)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := baseClient.WithContext(ctx)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	r, err := client.AllocFS().Cat(alloc, "alloc/logs/task.stdout.0", nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	// Read a byte to make sure the request is actually in flight before
+	// cancelling.
+	buf := make([]byte, 1)
+	_, err = r.Read(buf)
+	require.NoError(t, err)
+
+	cancel()
+
+	// The remaining read should now fail because the base context ended
+	// the request, rather than blocking until the (effectively unbounded)
+	// server finishes writing.
+	_, err = io.ReadAll(r)
+	require.Error(t, err)
+
+	select {
+	case <-serverDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server never observed the client disconnect")
+	}
+}
+
+func TestFS_List_ResponseTooLarge(t *testing.T) {
+	t.Parallel()
+
+	var entries []*AllocFileInfo
+	for i := 0; i < 100; i++ {
+		entries = append(entries, &AllocFileInfo{Name: strings.Repeat("x", 1024)})
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	config.MaxFSResponseBytes = 1024
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	_, _, err = client.AllocFS().List(alloc, "/", nil)
+	require.Error(t, err)
+	var tooLarge *ErrResponseTooLarge
+	require.True(t, errors.As(err, &tooLarge))
+	require.Equal(t, int64(1024), tooLarge.Limit)
+}
+
+func TestFS_List_UnderLimitSucceeds(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]*AllocFileInfo{{Name: "small.log"}})
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	config.MaxFSResponseBytes = 1024
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	entries, _, err := client.AllocFS().List(alloc, "/", nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "small.log", entries[0].Name)
+}
+
+func TestFS_Stat_ResponseTooLarge(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Name":"` + strings.Repeat("y", 2048) + `"}`))
+	}))
+	defer ts.Close()
+
+	config := DefaultConfig()
+	config.Address = ts.URL
+	config.MaxFSResponseBytes = 64
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	_, _, err = client.AllocFS().Stat(alloc, "foo", nil)
+	require.Error(t, err)
+	var tooLarge *ErrResponseTooLarge
+	require.True(t, errors.As(err, &tooLarge))
+}
+
+func TestFS_Stat_DetectContentType(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		content  []byte
+		wantType string
+	}{
+		{
+			name:     "text",
+			content:  []byte("hello world, this is plain text content\n"),
+			wantType: "text/plain; charset=utf-8",
+		},
+		{
+			name:     "gzip",
+			content:  []byte{0x1f, 0x8b, 0x08, 0, 0, 0, 0, 0, 0, 0xff, 0x01, 0x02, 0x03},
+			wantType: "application/x-gzip",
+		},
+		{
+			name:     "binary",
+			content:  []byte{0x00, 0x01, 0x02, 0xff, 0xfe, 0xfd, 0x10, 0x20, 0x30, 0x00, 0x00, 0x00},
+			wantType: "application/octet-stream",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+					b, _ := json.Marshal(&AllocFileInfo{Name: "f", Size: int64(len(tc.content))})
+					w.Write(b)
+				case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+					w.Write(tc.content)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+
+			config := DefaultConfig()
+			config.Address = srv.URL
+			client, err := NewClient(config)
+			require.NoError(t, err)
+
+			alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+			info, _, err := client.AllocFS().Stat(alloc, "f", &QueryOptions{DetectContentType: true})
+			require.NoError(t, err)
+			require.Equal(t, tc.wantType, info.ContentType)
+		})
+	}
+}
+
+func TestFS_Stat_DetectContentTypeOptOut(t *testing.T) {
+	t.Parallel()
+
+	var readAtCalled bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Name: "f", Size: 10})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+			readAtCalled = true
+			w.Write([]byte("0123456789"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	info, _, err := client.AllocFS().Stat(alloc, "f", nil)
+	require.NoError(t, err)
+	require.Empty(t, info.ContentType)
+	require.False(t, readAtCalled)
+}
+
+func TestFS_LogsLinesTimestamped(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/logs/") {
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("one\n")}))
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("two\n")}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	lines, errCh := client.AllocFS().LogsLinesTimestamped(alloc, false, "task", "stdout", OriginStart, 0,
+		TimestampRFC3339, cancel, nil)
+
+	got := collectStreamLines(t, lines, errCh)
+	require.Len(t, got, 2)
+	for i, want := range []string{"one", "two"} {
+		parts := strings.SplitN(got[i], " ", 2)
+		require.Len(t, parts, 2)
+		_, err := time.Parse(time.RFC3339, parts[0])
+		require.NoError(t, err)
+		require.Equal(t, want, parts[1])
+	}
+}
+
+func TestFS_LogsLinesTimestamped_UnixFormat(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/logs/") {
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("hello\n")}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	lines, errCh := client.AllocFS().LogsLinesTimestamped(alloc, false, "task", "stdout", OriginStart, 0,
+		TimestampUnix, cancel, nil)
+
+	got := collectStreamLines(t, lines, errCh)
+	require.Len(t, got, 1)
+	parts := strings.SplitN(got[0], " ", 2)
+	require.Len(t, parts, 2)
+	_, err = strconv.ParseInt(parts[0], 10, 64)
+	require.NoError(t, err)
+	require.Equal(t, "hello", parts[1])
+}
+
+func TestFS_TaskFS_ResolvesTaskRelativePaths(t *testing.T) {
+	t.Parallel()
+
+	const content = "listen 6379"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			require.Equal(t, "redis/local", r.URL.Query().Get("path"))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]*AllocFileInfo{{Name: "config.conf", Size: int64(len(content))}})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			require.Equal(t, "redis/local/config.conf", r.URL.Query().Get("path"))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&AllocFileInfo{Name: "config.conf", Size: int64(len(content))})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			require.Equal(t, "redis/local/config.conf", r.URL.Query().Get("path"))
+			w.Write([]byte(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	taskFS := client.AllocFS().TaskFS(alloc, "redis")
+
+	entries, _, err := taskFS.List("local", nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	info, _, err := taskFS.Stat("local/config.conf", nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), info.Size)
+
+	r, err := taskFS.Cat("local/config.conf", nil)
+	require.NoError(t, err)
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, content, string(got))
+}
+
+func TestFS_WaitForTaskExitWithLogTail_RetainedLogs(t *testing.T) {
+	t.Parallel()
+
+	logContent := []byte("line one\nline two\nline three\n")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/allocation/abc123":
+			alloc := &Allocation{ID: "abc123", TaskStates: map[string]*TaskState{
+				"web": {Events: []*TaskEvent{
+					{Type: TaskStarted},
+					{Type: TaskTerminated, ExitCode: 0},
+				}},
+			}}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(alloc)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]*AllocFileInfo{
+				{Name: "web.stdout.0", Size: int64(len(logContent))},
+			})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&AllocFileInfo{Name: "web.stdout.0", Size: int64(len(logContent))})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+			offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+			limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+			end := offset + limit
+			if end > int64(len(logContent)) {
+				end = int64(len(logContent))
+			}
+			w.Write(logContent[offset:end])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	result, err := client.AllocFS().WaitForTaskExitWithLogTail(context.Background(), alloc, "web", 2, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.False(t, result.LogsUnavailable)
+	require.Equal(t, 0, result.ExitCode)
+	require.Equal(t, []string{"line two", "line three"}, result.LogTail)
+}
+
+func TestFS_WaitForTaskExitWithLogTail_LogsGCd(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/allocation/abc123":
+			alloc := &Allocation{ID: "abc123", TaskStates: map[string]*TaskState{
+				"web": {Events: []*TaskEvent{
+					{Type: TaskTerminated, ExitCode: 1},
+				}},
+			}}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(alloc)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			// The alloc's logs directory is already gone.
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]*AllocFileInfo{})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	result, err := client.AllocFS().WaitForTaskExitWithLogTail(context.Background(), alloc, "web", 2, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, result.LogsUnavailable)
+	require.Nil(t, result.LogTail)
+	require.Equal(t, 1, result.ExitCode)
+}
+
+// streamLimitTestServer holds /v1/client/fs/stream/ requests open until
+// release is closed, so tests can assert on the number of concurrently
+// open streams.
+func streamLimitTestServer(t *testing.T, opened chan<- struct{}, release <-chan struct{}) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			http.NotFound(w, r)
+			return
+		}
+		opened <- struct{}{}
+		// Flush headers immediately so the client's synchronous HTTP round
+		// trip completes and hands the still-open body to the background
+		// frame-reading goroutine, instead of blocking the whole Stream
+		// call until release closes.
+		w.(http.Flusher).Flush()
+		<-release
+		json.NewEncoder(w).Encode(&StreamFrame{Data: []byte("done\n")})
+	}))
+}
+
+func TestFS_SetStreamLimit_ErrorPolicy(t *testing.T) {
+	t.Parallel()
+
+	opened := make(chan struct{}, 10)
+	release := make(chan struct{})
+	srv := streamLimitTestServer(t, opened, release)
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	fs := client.AllocFS()
+	fs.SetStreamLimit(1, StreamLimitError)
+
+	cancel1 := make(chan struct{})
+	defer close(cancel1)
+	_, errCh1 := fs.Stream(alloc, "log", OriginStart, 0, cancel1, nil)
+
+	select {
+	case <-opened:
+	case err := <-errCh1:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for first stream to open")
+	}
+
+	cancel2 := make(chan struct{})
+	defer close(cancel2)
+	_, errCh2 := fs.Stream(alloc, "log", OriginStart, 0, cancel2, nil)
+	select {
+	case err := <-errCh2:
+		require.True(t, errors.Is(err, ErrStreamLimitReached))
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for second stream to be rejected")
+	}
+
+	close(release)
+}
+
+func TestFS_SetStreamLimit_BlockPolicy(t *testing.T) {
+	t.Parallel()
+
+	opened := make(chan struct{}, 10)
+	release := make(chan struct{})
+	srv := streamLimitTestServer(t, opened, release)
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	fs := client.AllocFS()
+	fs.SetStreamLimit(1, StreamLimitBlock)
+
+	cancel1 := make(chan struct{})
+	defer close(cancel1)
+	_, errCh1 := fs.Stream(alloc, "log", OriginStart, 0, cancel1, nil)
+
+	select {
+	case <-opened:
+	case err := <-errCh1:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for first stream to open")
+	}
+
+	cancel2 := make(chan struct{})
+	defer close(cancel2)
+	secondStarted := make(chan struct{})
+	go func() {
+		fs.Stream(alloc, "log", OriginStart, 0, cancel2, nil)
+		close(secondStarted)
+	}()
+
+	select {
+	case <-opened:
+		t.Fatal("second stream opened before the first released its slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-opened:
+	case <-time.After(2 * time.Second):
+		t.Fatal("second stream never opened after the first released its slot")
+	}
+}
+
+// TestFS_SetStreamLimit_AppliesToOtherStreamHelpers covers StreamWithKeepalive,
+// StreamLines, and StreamSSE, not just Stream itself: each of them opens its
+// own connection to the node's /fs/stream endpoint, so each must be bounded
+// by SetStreamLimit too.
+func TestFS_SetStreamLimit_AppliesToOtherStreamHelpers(t *testing.T) {
+	t.Parallel()
+
+	openOne := func(t *testing.T, fs *AllocFS, alloc *Allocation, cancel <-chan struct{}) <-chan error {
+		t.Helper()
+		_, errCh := fs.StreamLines(alloc, "log", OriginStart, 0, StreamConfig{}, nil, cancel, nil)
+		return errCh
+	}
+
+	opened := make(chan struct{}, 10)
+	release := make(chan struct{})
+	srv := streamLimitTestServer(t, opened, release)
+	defer srv.Close()
+	defer close(release)
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	fs := client.AllocFS()
+	fs.SetStreamLimit(1, StreamLimitError)
+
+	cancel1 := make(chan struct{})
+	defer close(cancel1)
+	errCh1 := openOne(t, fs, alloc, cancel1)
+
+	select {
+	case <-opened:
+	case err := <-errCh1:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for first StreamLines to open")
+	}
+
+	cancel2 := make(chan struct{})
+	defer close(cancel2)
+	errCh2 := openOne(t, fs, alloc, cancel2)
+	select {
+	case err := <-errCh2:
+		require.True(t, errors.Is(err, ErrStreamLimitReached))
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for second StreamLines to be rejected")
+	}
+}
+
+// TestFS_StreamWithKeepalive_DirectoryError covers StreamWithKeepalive's
+// QueryOptions.CheckDirectory path, mirroring Stream's own ErrIsDirectory
+// translation.
+func TestFS_StreamWithKeepalive_DirectoryError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Name: "somedir", IsDir: true})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/"):
+			t.Error("stream endpoint should not have been hit for a directory")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	_, errCh := client.AllocFS().StreamWithKeepalive(alloc, "somedir", OriginStart, 0, nil, cancel,
+		&QueryOptions{CheckDirectory: true})
+
+	err = <-errCh
+	require.True(t, errors.Is(err, ErrIsDirectory), "got: %v", err)
+}
+
+// TestFS_StreamLines_ConnectRetrySucceedsAfter503s covers StreamLines'
+// QueryOptions.ConnectRetry* handling, mirroring Stream's own connect-retry
+// coverage.
+func TestFS_StreamLines_ConnectRetrySucceedsAfter503s(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			http.NotFound(w, r)
+			return
+		}
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := json.Marshal(&StreamFrame{Data: []byte("hello\n")})
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	q := &QueryOptions{
+		ConnectRetryStatusCodes: []int{http.StatusServiceUnavailable},
+		ConnectRetryMaxDuration: 5 * time.Second,
+	}
+
+	lines, errCh := client.AllocFS().StreamLines(alloc, "log", OriginStart, 0, StreamConfig{}, nil, cancel, q)
+
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	default:
+	}
+
+	require.Equal(t, []string{"hello"}, got)
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+}
+
+// TestFS_StreamSSE_SetupTimesOutOnSlowConnect covers StreamSSE's
+// QueryOptions.SetupTimeout handling, mirroring Stream's own setup-timeout
+// coverage.
+func TestFS_StreamSSE_SetupTimesOutOnSlowConnect(t *testing.T) {
+	t.Parallel()
+
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			http.NotFound(w, r)
+			return
+		}
+		<-unblock
+		b, _ := json.Marshal(&StreamFrame{Data: []byte("too late")})
+		w.Write(b)
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	q := &QueryOptions{SetupTimeout: 50 * time.Millisecond}
+
+	frames, errCh := client.AllocFS().StreamSSE(alloc, "log", OriginStart, 0, cancel, q)
+	require.Nil(t, frames)
+
+	err = <-errCh
+	var timeout *ErrStreamSetupTimeout
+	require.True(t, errors.As(err, &timeout))
+	require.Equal(t, 50*time.Millisecond, timeout.Timeout)
+}
+
+func TestFS_StreamWithMaxDuration_EndsCleanlyAfterTimeout(t *testing.T) {
+	t.Parallel()
+
+	serverDone := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		for i := 0; i < 10000; i++ {
+			select {
+			case <-r.Context().Done():
+				close(serverDone)
+				return
+			default:
+			}
+			if err := enc.Encode(&StreamFrame{Data: []byte("x")}); err != nil {
+				close(serverDone)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, errCh := client.AllocFS().StreamWithMaxDuration(alloc, "log", OriginStart, 0, 50*time.Millisecond, cancel, nil)
+
+	drained := false
+	timeout := time.After(2 * time.Second)
+drain:
+	for {
+		select {
+		case _, ok := <-frames:
+			if !ok {
+				drained = true
+				break drain
+			}
+		case err := <-errCh:
+			t.Fatalf("unexpected error from a MaxDuration timeout: %v", err)
+		case <-timeout:
+			t.Fatal("stream never ended after MaxDuration elapsed")
+		}
+	}
+
+	require.True(t, drained, "frames channel should have closed once MaxDuration elapsed")
+
+	select {
+	case <-serverDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server never observed the client disconnect after MaxDuration elapsed")
+	}
+}
+
+func TestFS_StreamWithMaxDuration_Disabled(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&StreamFrame{Data: []byte("hello")})
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, errCh := client.AllocFS().StreamWithMaxDuration(alloc, "log", OriginStart, 0, 0, cancel, nil)
+
+	select {
+	case f, ok := <-frames:
+		require.True(t, ok)
+		require.Equal(t, []byte("hello"), f.Data)
+	case err := <-errCh:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for frame")
+	}
+}
+
+func TestFS_StreamFollowWithMaxDuration_EndsCleanlyAfterTimeout(t *testing.T) {
+	t.Parallel()
+
+	serverDone := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		for i := 0; i < 10000; i++ {
+			select {
+			case <-r.Context().Done():
+				close(serverDone)
+				return
+			default:
+			}
+			if err := enc.Encode(&StreamFrame{Data: []byte("x")}); err != nil {
+				close(serverDone)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, errCh := client.AllocFS().StreamFollowWithMaxDuration(alloc, "log", 0, nil, false, 50*time.Millisecond, cancel, nil)
+
+	drained := false
+	timeout := time.After(2 * time.Second)
+drain:
+	for {
+		select {
+		case _, ok := <-frames:
+			if !ok {
+				drained = true
+				break drain
+			}
+		case err := <-errCh:
+			t.Fatalf("unexpected error from a MaxDuration timeout: %v", err)
+		case <-timeout:
+			t.Fatal("stream never ended after MaxDuration elapsed")
+		}
+	}
+
+	require.True(t, drained, "frames channel should have closed once MaxDuration elapsed")
+
+	select {
+	case <-serverDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server never observed the client disconnect after MaxDuration elapsed")
+	}
+}
+
+func TestFS_IsDir(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("path") {
+		case "adir":
+			json.NewEncoder(w).Encode(&AllocFileInfo{Name: "adir", IsDir: true})
+		case "afile":
+			json.NewEncoder(w).Encode(&AllocFileInfo{Name: "afile", IsDir: false, Size: 5})
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	fs := client.AllocFS()
+
+	isDir, err := fs.IsDir(alloc, "adir", nil)
+	require.NoError(t, err)
+	require.True(t, isDir)
+
+	isDir, err = fs.IsDir(alloc, "afile", nil)
+	require.NoError(t, err)
+	require.False(t, isDir)
+
+	_, err = fs.IsDir(alloc, "missing", nil)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrFileNotFound))
+}
+
+func TestFS_StreamLines_SanitizeUTF8(t *testing.T) {
+	t.Parallel()
+
+	invalid := []byte("bad\xffline\n")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: invalid}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	lines, errCh := client.AllocFS().StreamLines(alloc, "log", OriginStart, 0,
+		StreamConfig{SanitizeUTF8: true}, nil, cancel, nil)
+
+	got := collectStreamLines(t, lines, errCh)
+	require.Equal(t, []string{"bad�line"}, got)
+	require.True(t, utf8.ValidString(got[0]))
+}
+
+func TestFS_StreamLines_SanitizeUTF8OptOut(t *testing.T) {
+	t.Parallel()
+
+	invalid := []byte("bad\xffline\n")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: invalid}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	lines, errCh := client.AllocFS().StreamLines(alloc, "log", OriginStart, 0,
+		StreamConfig{}, nil, cancel, nil)
+
+	got := collectStreamLines(t, lines, errCh)
+	require.Equal(t, []string{string(invalid[:len(invalid)-1])}, got)
+	require.False(t, utf8.ValidString(got[0]))
+}
+
+// backpressureTestServer streams total numbered lines as fast as it can, so
+// a consumer that doesn't drain StreamLines's channel right away falls
+// behind the small internal buffers.
+func backpressureTestServer(t *testing.T, total int) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		enc := json.NewEncoder(w)
+		for i := 0; i < total; i++ {
+			require.NoError(t, enc.Encode(&StreamFrame{Data: []byte(fmt.Sprintf("line%d\n", i))}))
+		}
+	}))
+}
+
+func TestFS_StreamLines_BackpressureBlockDropsNothing(t *testing.T) {
+	t.Parallel()
+
+	const total = 30
+	srv := backpressureTestServer(t, total)
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	var dropped int32
+	lines, errCh := client.AllocFS().StreamLines(alloc, "log", OriginStart, 0,
+		StreamConfig{
+			BackpressurePolicy: StreamBackpressureBlock,
+			OnDrop:             func(n int) { atomic.StoreInt32(&dropped, int32(n)) },
+		}, nil, cancel, nil)
+
+	// Let the server get well ahead of this slow consumer before draining.
+	time.Sleep(100 * time.Millisecond)
+
+	got := collectStreamLines(t, lines, errCh)
+
+	require.Zero(t, atomic.LoadInt32(&dropped))
+	require.Len(t, got, total)
+	require.Equal(t, "line0", got[0])
+	require.Equal(t, fmt.Sprintf("line%d", total-1), got[len(got)-1])
+}
+
+func TestFS_StreamLines_BackpressureDropNewest(t *testing.T) {
+	t.Parallel()
+
+	const total = 30
+	srv := backpressureTestServer(t, total)
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	var dropped int32
+	lines, errCh := client.AllocFS().StreamLines(alloc, "log", OriginStart, 0,
+		StreamConfig{
+			BackpressurePolicy: StreamBackpressureDropNewest,
+			OnDrop:             func(n int) { atomic.StoreInt32(&dropped, int32(n)) },
+		}, nil, cancel, nil)
+
+	// Let the server race ahead of this slow consumer so the buffer fills
+	// and DropNewest starts discarding before anything is read.
+	time.Sleep(100 * time.Millisecond)
+
+	got := collectStreamLines(t, lines, errCh)
+
+	gotDropped := int(atomic.LoadInt32(&dropped))
+	require.NotZero(t, gotDropped)
+	require.Len(t, got, total-gotDropped)
+	// DropNewest keeps the earliest lines and discards later arrivals.
+	require.Equal(t, "line0", got[0])
+}
+
+func TestFS_StreamLines_BackpressureDropOldest(t *testing.T) {
+	t.Parallel()
+
+	const total = 30
+	srv := backpressureTestServer(t, total)
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	var dropped int32
+	lines, errCh := client.AllocFS().StreamLines(alloc, "log", OriginStart, 0,
+		StreamConfig{
+			BackpressurePolicy: StreamBackpressureDropOldest,
+			OnDrop:             func(n int) { atomic.StoreInt32(&dropped, int32(n)) },
+		}, nil, cancel, nil)
+
+	// Let the server race ahead of this slow consumer so the buffer fills
+	// and DropOldest starts evicting before anything is read.
+	time.Sleep(100 * time.Millisecond)
+
+	got := collectStreamLines(t, lines, errCh)
+
+	gotDropped := int(atomic.LoadInt32(&dropped))
+	require.NotZero(t, gotDropped)
+	require.Len(t, got, total-gotDropped)
+	// DropOldest evicts earlier lines to make room, so the last line
+	// produced always survives.
+	require.Equal(t, fmt.Sprintf("line%d", total-1), got[len(got)-1])
+}
+
+func listTreeTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	// Fixture tree:
+	// /
+	//   file1
+	//   dir1/
+	//     fileA
+	//     fileB
+	tree := map[string][]*AllocFileInfo{
+		"": {
+			{Name: "file1", IsDir: false, Size: 5},
+			{Name: "dir1", IsDir: true},
+		},
+		"dir1": {
+			{Name: "fileA", IsDir: false, Size: 1},
+			{Name: "fileB", IsDir: false, Size: 2},
+		},
+	}
+	info := map[string]*AllocFileInfo{
+		"":     {Name: "/", IsDir: true},
+		"dir1": {Name: "dir1", IsDir: true},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			entries, ok := tree[path]
+			if !ok {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(entries)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			if fi, ok := info[path]; ok {
+				json.NewEncoder(w).Encode(fi)
+				return
+			}
+			http.Error(w, "not found", http.StatusNotFound)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+}
+
+func TestFS_ListRecursive(t *testing.T) {
+	t.Parallel()
+
+	srv := listTreeTestServer(t)
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	entries, err := client.AllocFS().ListRecursive(alloc, "", nil)
+	require.NoError(t, err)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	require.ElementsMatch(t, []string{"file1", "dir1", "fileA", "fileB"}, names)
+}
+
+func TestFS_Manifest_MatchesFixtureAndHashes(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	content := map[string][]byte{
+		"file1":      []byte("hello"),
+		"dir1/fileA": []byte("a"),
+		"dir1/fileB": []byte("bb"),
+	}
+
+	tree := map[string][]*AllocFileInfo{
+		"": {
+			{Name: "file1", IsDir: false, Size: 5, FileMode: "-rw-r--r--", ModTime: mtime},
+			{Name: "dir1", IsDir: true, FileMode: "drwxr-xr-x", ModTime: mtime},
+		},
+		"dir1": {
+			{Name: "fileA", IsDir: false, Size: 1, FileMode: "-rw-r--r--", ModTime: mtime},
+			{Name: "fileB", IsDir: false, Size: 2, FileMode: "-rw-r--r--", ModTime: mtime},
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			entries, ok := tree[path]
+			if !ok {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(entries)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			b, ok := content[path]
+			if !ok {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			w.Write(b)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	entries, err := client.AllocFS().Manifest(alloc, "", nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	byPath := make(map[string]ManifestEntry, len(entries))
+	for _, e := range entries {
+		byPath[e.Path] = e
+	}
+
+	for path, want := range content {
+		got, ok := byPath[path]
+		require.True(t, ok, "missing manifest entry for %s", path)
+
+		sum := sha256.Sum256(want)
+		require.Equal(t, hex.EncodeToString(sum[:]), got.SHA256)
+		require.Equal(t, int64(len(want)), got.Size)
+		require.Equal(t, os.FileMode(0644), got.Mode)
+		require.True(t, mtime.Equal(got.ModTime))
+	}
+}
+
+func TestFS_ListSinceAllocStart(t *testing.T) {
+	t.Parallel()
+
+	allocStart := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	entries := []*AllocFileInfo{
+		{Name: "stale.log", ModTime: allocStart.Add(-time.Hour)},
+		{Name: "boundary.log", ModTime: allocStart},
+		{Name: "fresh.log", ModTime: allocStart.Add(time.Minute)},
+		{Name: "newer.log", ModTime: allocStart.Add(time.Hour)},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/") {
+			http.NotFound(w, r)
+			return
+		}
+		b, _ := json.Marshal(entries)
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown", CreateTime: allocStart.UnixNano()}
+
+	got, _, err := client.AllocFS().ListSinceAllocStart(alloc, "alloc/logs", nil)
+	require.NoError(t, err)
+
+	var names []string
+	for _, e := range got {
+		names = append(names, e.Name)
+	}
+	require.ElementsMatch(t, []string{"fresh.log", "newer.log"}, names)
+}
+
+func TestFS_ListTree(t *testing.T) {
+	t.Parallel()
+
+	srv := listTreeTestServer(t)
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	root, err := client.AllocFS().ListTree(alloc, "", -1, nil)
+	require.NoError(t, err)
+
+	require.True(t, root.Info.IsDir)
+	require.Len(t, root.Children, 2)
+
+	var dir1 *FileNode
+	for _, c := range root.Children {
+		if c.Info.Name == "dir1" {
+			dir1 = c
+		}
+	}
+	require.NotNil(t, dir1)
+	require.True(t, dir1.Info.IsDir)
+	require.Len(t, dir1.Children, 2)
+
+	var childNames []string
+	for _, c := range dir1.Children {
+		childNames = append(childNames, c.Info.Name)
+	}
+	require.ElementsMatch(t, []string{"fileA", "fileB"}, childNames)
+}
+
+func TestFS_ListTree_MaxDepthZero(t *testing.T) {
+	t.Parallel()
+
+	srv := listTreeTestServer(t)
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	root, err := client.AllocFS().ListTree(alloc, "", 0, nil)
+	require.NoError(t, err)
+	require.True(t, root.Info.IsDir)
+	require.Nil(t, root.Children)
+}
+
+func TestFS_StreamIfModified_Unchanged(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Now().Truncate(time.Second)
+	var streamOpened bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			json.NewEncoder(w).Encode(&AllocFileInfo{Name: "log", Size: 100, ModTime: mtime})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/"):
+			streamOpened = true
+			json.NewEncoder(w).Encode(&StreamFrame{Data: []byte("x")})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	baseline := &AllocFileInfo{Size: 100, ModTime: mtime}
+	frames, errCh, notModified, err := client.AllocFS().StreamIfModified(alloc, "log", OriginStart, 0, baseline, cancel, nil)
+	require.NoError(t, err)
+	require.True(t, notModified)
+	require.Nil(t, frames)
+	require.Nil(t, errCh)
+	require.False(t, streamOpened)
+}
+
+func TestFS_StreamIfModified_Changed(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Now().Truncate(time.Second)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			json.NewEncoder(w).Encode(&AllocFileInfo{Name: "log", Size: 200, ModTime: mtime.Add(time.Minute)})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/"):
+			json.NewEncoder(w).Encode(&StreamFrame{Data: []byte("x")})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	baseline := &AllocFileInfo{Size: 100, ModTime: mtime}
+	frames, errCh, notModified, err := client.AllocFS().StreamIfModified(alloc, "log", OriginStart, 0, baseline, cancel, nil)
+	require.NoError(t, err)
+	require.False(t, notModified)
+
+	select {
+	case f := <-frames:
+		require.Equal(t, []byte("x"), f.Data)
+	case err := <-errCh:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for frame")
+	}
+}
+
+func TestFS_ListRecursive_PartialResultsOnSubdirError(t *testing.T) {
+	t.Parallel()
+
+	// Fixture tree:
+	// /
+	//   dir1/     -> 403 when listed
+	//   dir2/
+	//     fileB
+	tree := map[string][]*AllocFileInfo{
+		"": {
+			{Name: "dir1", IsDir: true},
+			{Name: "dir2", IsDir: true},
+		},
+		"dir2": {
+			{Name: "fileB", IsDir: false, Size: 2},
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/") {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		path := r.URL.Query().Get("path")
+		if path == "dir1" {
+			http.Error(w, "Permission denied", http.StatusForbidden)
+			return
+		}
+		entries, ok := tree[path]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(entries)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	entries, err := client.AllocFS().ListRecursive(alloc, "", nil)
+	require.Error(t, err)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	require.ElementsMatch(t, []string{"dir1", "dir2", "fileB"}, names)
+}
+
+func TestFS_ListTree_PartialResultsOnSubdirError(t *testing.T) {
+	t.Parallel()
+
+	tree := map[string][]*AllocFileInfo{
+		"": {
+			{Name: "dir1", IsDir: true},
+			{Name: "dir2", IsDir: true},
+		},
+		"dir2": {
+			{Name: "fileB", IsDir: false, Size: 2},
+		},
+	}
+	info := map[string]*AllocFileInfo{
+		"":     {Name: "/", IsDir: true},
+		"dir1": {Name: "dir1", IsDir: true},
+		"dir2": {Name: "dir2", IsDir: true},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			if fi, ok := info[path]; ok {
+				json.NewEncoder(w).Encode(fi)
+				return
+			}
+			http.Error(w, "not found", http.StatusNotFound)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/ls/"):
+			if path == "dir1" {
+				http.Error(w, "Permission denied", http.StatusForbidden)
+				return
+			}
+			entries, ok := tree[path]
+			if !ok {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(entries)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	root, err := client.AllocFS().ListTree(alloc, "", -1, nil)
+	require.Error(t, err)
+	require.NotNil(t, root)
+	require.Len(t, root.Children, 2)
+
+	var dir1, dir2 *FileNode
+	for _, c := range root.Children {
+		switch c.Info.Name {
+		case "dir1":
+			dir1 = c
+		case "dir2":
+			dir2 = c
+		}
+	}
+	require.NotNil(t, dir1)
+	require.Nil(t, dir1.Children)
+	require.NotNil(t, dir2)
+	require.Len(t, dir2.Children, 1)
+	require.Equal(t, "fileB", dir2.Children[0].Info.Name)
+}
+
+func TestFS_ScanDelim_NULDelimitedAcrossFrames(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("rec")}))
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("ord1\x00rec")}))
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("ord2\x00")}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	records, errCh := client.AllocFS().ScanDelim(alloc, "log", '\x00', cancel, nil)
+	got := collectStreamLines(t, records, errCh)
+	require.Equal(t, []string{"record1", "record2"}, got)
+}
+
+func TestFS_CatChecked_Authorized(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("hello world")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			json.NewEncoder(w).Encode(&AllocFileInfo{Name: "f", Size: int64(len(content))})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	r, err := client.AllocFS().CatChecked(alloc, "f", nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, content, got)
+}
+
+func TestFS_CatChecked_Unauthorized(t *testing.T) {
+	t.Parallel()
+
+	var catCalled bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			catCalled = true
+		}
+		http.Error(w, "Permission denied", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	_, err = client.AllocFS().CatChecked(alloc, "f", nil)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrPermissionDenied))
+	require.False(t, catCalled, "Cat should never be called once the pre-check fails")
+}
+
+func TestFS_CatRetryable_ResumesAfterTransientError(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var catCalls int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			json.NewEncoder(w).Encode(&AllocFileInfo{Name: "f", Size: int64(len(content))})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			if atomic.AddInt32(&catCalls, 1) == 1 {
+				// Write half the content, then drop the connection to
+				// simulate a transient network failure partway through.
+				w.Write(content[:len(content)/2])
+				hj, ok := w.(http.Hijacker)
+				require.True(t, ok)
+				conn, _, err := hj.Hijack()
+				require.NoError(t, err)
+				conn.Close()
+				return
+			}
+			w.Write(content)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+			offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+			limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+			end := offset + limit
+			if end > int64(len(content)) {
+				end = int64(len(content))
+			}
+			w.Write(content[offset:end])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	rr, err := client.AllocFS().CatRetryable(alloc, "f", nil)
+	require.NoError(t, err)
+	defer rr.Close()
+
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, rr)
+	require.NoError(t, err)
+	require.Equal(t, content, buf.Bytes())
+}
+
+func TestFS_List_IncludeFullPath(t *testing.T) {
+	t.Parallel()
+
+	srv := listTreeTestServer(t)
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	entries, _, err := client.AllocFS().List(alloc, "", &QueryOptions{IncludeFullPath: true})
+	require.NoError(t, err)
+
+	got := map[string]string{}
+	for _, e := range entries {
+		got[e.Name] = e.FullPath
+	}
+	require.Equal(t, map[string]string{"file1": "file1", "dir1": "dir1"}, got)
+
+	entries, _, err = client.AllocFS().List(alloc, "dir1", &QueryOptions{IncludeFullPath: true})
+	require.NoError(t, err)
+	got = map[string]string{}
+	for _, e := range entries {
+		got[e.Name] = e.FullPath
+	}
+	require.Equal(t, map[string]string{"fileA": "dir1/fileA", "fileB": "dir1/fileB"}, got)
+}
+
+func TestFS_List_FullPathEmptyByDefault(t *testing.T) {
+	t.Parallel()
+
+	srv := listTreeTestServer(t)
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	entries, _, err := client.AllocFS().List(alloc, "", nil)
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.Empty(t, e.FullPath)
+	}
+}
+
+func TestFS_ListRecursive_IncludeFullPath(t *testing.T) {
+	t.Parallel()
+
+	srv := listTreeTestServer(t)
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	entries, err := client.AllocFS().ListRecursive(alloc, "", &QueryOptions{IncludeFullPath: true})
+	require.NoError(t, err)
+
+	got := map[string]string{}
+	for _, e := range entries {
+		got[e.Name] = e.FullPath
+	}
+	require.Equal(t, map[string]string{
+		"file1": "file1",
+		"dir1":  "dir1",
+		"fileA": "dir1/fileA",
+		"fileB": "dir1/fileB",
+	}, got)
+}
+
+func TestFS_GrowthRate(t *testing.T) {
+	t.Parallel()
+
+	var size int64 = 100
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cur := atomic.AddInt64(&size, 100)
+		b, _ := json.Marshal(&AllocFileInfo{Name: "f", Size: cur})
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	window := 10 * time.Millisecond
+	rate, err := client.AllocFS().GrowthRate(alloc, "f", window, nil)
+	require.NoError(t, err)
+	require.Greater(t, rate, 0.0)
+}
+
+func TestFS_GrowthRate_UsesClockNotRealSleep(t *testing.T) {
+	t.Parallel()
+
+	var size int64 = 100
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cur := atomic.AddInt64(&size, 100)
+		b, _ := json.Marshal(&AllocFileInfo{Name: "f", Size: cur})
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	fs := client.AllocFS()
+	fs.setClock(newManualClock())
+
+	// A real time.Sleep(window) here would make this test take an hour;
+	// with the clock abstraction it returns immediately.
+	window := time.Hour
+	rate, err := fs.GrowthRate(alloc, "f", window, nil)
+	require.NoError(t, err)
+	require.Greater(t, rate, 0.0)
+}
+
+func TestFS_IsStalled(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := json.Marshal(&AllocFileInfo{Name: "f", Size: 100})
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	stalled, err := client.AllocFS().IsStalled(alloc, "f", 10*time.Millisecond, 1, nil)
+	require.NoError(t, err)
+	require.True(t, stalled)
+}
+
+func TestFS_StreamWindow_BackfillsAndFollowsWithoutDuplication(t *testing.T) {
+	t.Parallel()
+
+	var statCalls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			n := atomic.AddInt32(&statCalls, 1)
+			size := int64(1000)
+			if n >= 2 {
+				size = 1500
+			}
+			b, _ := json.Marshal(&AllocFileInfo{Name: "f", Size: size})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/"):
+			offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+			require.EqualValues(t, 500, offset)
+
+			flusher, _ := w.(http.Flusher)
+			enc := json.NewEncoder(w)
+
+			backlog := bytes.Repeat([]byte("b"), int(1500-offset))
+			require.NoError(t, enc.Encode(&StreamFrame{Offset: offset, Data: backlog}))
+			if flusher != nil {
+				flusher.Flush()
+			}
+
+			time.Sleep(20 * time.Millisecond)
+
+			require.NoError(t, enc.Encode(&StreamFrame{Offset: 1500, Data: []byte("live")}))
+			if flusher != nil {
+				flusher.Flush()
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	fs := client.AllocFS()
+	fs.setClock(newManualClock())
+
+	frames, errCh := fs.StreamWindow(alloc, "f", 500*time.Millisecond, cancel, nil)
+
+	got, err := drainStreamFollow(t, frames, errCh)
+	require.NoError(t, err)
+
+	want := append(bytes.Repeat([]byte("b"), 1000), []byte("live")...)
+	require.Equal(t, want, got)
+	require.EqualValues(t, 3, atomic.LoadInt32(&statCalls))
+}
+
+// fakeTimer is a deterministic clockTimer for testing timeout-based
+// behavior without real sleeps: it only fires when the test explicitly
+// calls fire, rather than after a wall-clock duration elapses.
+type fakeTimer struct {
+	c       chan time.Time
+	stopped bool
+	resets  int32
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	wasRunning := !t.stopped
+	t.stopped = true
+	return wasRunning
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	wasRunning := !t.stopped
+	t.stopped = false
+	atomic.AddInt32(&t.resets, 1)
+	return wasRunning
+}
+
+func (t *fakeTimer) fire() {
+	t.c <- time.Time{}
+}
+
+func TestFS_StreamWithHeartbeatTimeout_FiresOnMissedHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	var timerMu sync.Mutex
+	var timer *fakeTimer
+
+	clk := &fakeClockFactory{
+		newTimer: func(d time.Duration) clockTimer {
+			timerMu.Lock()
+			defer timerMu.Unlock()
+			timer = &fakeTimer{c: make(chan time.Time, 1)}
+			return timer
+		},
+	}
+
+	serverDone := make(chan struct{})
+	var closeServerDone sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		for {
+			select {
+			case <-r.Context().Done():
+				closeServerDone.Do(func() { close(serverDone) })
+				return
+			default:
+			}
+			enc.Encode(&StreamFrame{})
+			flusher.Flush()
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	fs := client.AllocFS()
+	fs.setClock(clk)
+
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	_, errCh := fs.StreamWithHeartbeatTimeout(alloc, "logs/redis.stdout.0", OriginStart, 0, time.Second, cancel, nil)
+
+	require.Eventually(t, func() bool {
+		timerMu.Lock()
+		defer timerMu.Unlock()
+		return timer != nil
+	}, 2*time.Second, time.Millisecond)
+
+	timerMu.Lock()
+	timer.fire()
+	timerMu.Unlock()
+
+	select {
+	case err := <-errCh:
+		require.True(t, errors.Is(err, ErrHeartbeatTimeout))
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected heartbeat timeout error")
+	}
+
+	select {
+	case <-serverDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not observe client disconnect")
+	}
+}
+
+// fakeClockFactory is a clock whose NewTimer delegates to a caller-supplied
+// func, so a test can capture and directly control the single timer a
+// method under test creates.
+type fakeClockFactory struct {
+	newTimer func(d time.Duration) clockTimer
+}
+
+func (f *fakeClockFactory) Now() time.Time                      { return time.Time{} }
+func (f *fakeClockFactory) NewTimer(d time.Duration) clockTimer { return f.newTimer(d) }
+
+// manualClock is a clock whose Now() only advances when the test tells it
+// to, so TTL- and sleep-based behavior can be driven deterministically
+// without waiting on real time.
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{now: time.Now()}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *manualClock) NewTimer(d time.Duration) clockTimer {
+	fired := make(chan time.Time, 1)
+	c.advance(d)
+	fired <- c.Now()
+	return &fakeTimer{c: fired}
+}
+
+func TestFS_LogsWithFileBoundary(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/logs/") {
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{File: "task.stdout.0", Data: []byte("a")}))
+		require.NoError(t, enc.Encode(&StreamFrame{File: "task.stdout.0", Data: []byte("b")}))
+		require.NoError(t, enc.Encode(&StreamFrame{File: "task.stdout.1", Data: []byte("c")}))
+		require.NoError(t, enc.Encode(&StreamFrame{File: "task.stdout.1", Data: []byte("d")}))
+		require.NoError(t, enc.Encode(&StreamFrame{File: "task.stdout.2", Data: []byte("e")}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	frames, errCh := client.AllocFS().LogsWithFileBoundary(alloc, false, "task", "stdout", OriginStart, 0, cancel, nil)
+
+	var got []*LogFrame
+loop:
+	for {
+		select {
+		case f, ok := <-frames:
+			if !ok {
+				break loop
+			}
+			got = append(got, f)
+		case err := <-errCh:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	require.Len(t, got, 5)
+
+	boundaries := 0
+	for i, f := range got {
+		wantBoundary := i == 0 || i == 2 || i == 4
+		require.Equal(t, wantBoundary, f.FileBoundary, "frame %d (file %s)", i, f.File)
+		if f.FileBoundary {
+			boundaries++
+		}
+	}
+	require.Equal(t, 3, boundaries)
+}
+
+func TestFS_CatWithAllocStatusCheck_AbortsWhenAllocStops(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("x"), 1024)
+	var infoCalls int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/allocation/abc123":
+			n := atomic.AddInt32(&infoCalls, 1)
+			status := AllocClientStatusRunning
+			if n >= 2 {
+				status = AllocClientStatusComplete
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&Allocation{ID: "abc123", ClientStatus: status})
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			flusher := w.(http.Flusher)
+			for i := 0; i < len(content); i += 64 {
+				end := i + 64
+				if end > len(content) {
+					end = len(content)
+				}
+				w.Write(content[i:end])
+				flusher.Flush()
+				time.Sleep(2 * time.Millisecond)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	r, err := client.AllocFS().CatWithAllocStatusCheck(alloc, "f", 5*time.Millisecond, nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	buf := make([]byte, 1)
+	var readErr error
+	for {
+		_, readErr = r.Read(buf)
+		if readErr != nil {
+			break
+		}
+	}
+
+	require.True(t, errors.Is(readErr, ErrAllocStopped), "got: %v", readErr)
+}
+
+func TestFS_CatWithAllocStatusCheck_Disabled(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("hello")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	r, err := client.AllocFS().CatWithAllocStatusCheck(alloc, "f", 0, nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, content, got)
+}
+
+func TestFS_SeekableReader(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("0123456789")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Size: int64(len(content))})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+			offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+			limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+			end := offset + limit
+			if end > int64(len(content)) {
+				end = int64(len(content))
+			}
+			if offset >= int64(len(content)) {
+				return
+			}
+			w.Write(content[offset:end])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	r, err := client.AllocFS().SeekableReader(alloc, "f", nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	buf := make([]byte, 3)
+
+	pos, err := r.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), pos)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "234", string(buf[:n]))
+
+	pos, err = r.Seek(2, io.SeekCurrent)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), pos)
+	n, err = r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "789", string(buf[:n]))
+
+	pos, err = r.Seek(-4, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), pos)
+	n, err = r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "678", string(buf[:n]))
+}
+
+func TestFS_SeekableReader_SeekPastEOF(t *testing.T) {
+	t.Parallel()
 
-	r := NewFrameReader(framesCh, errCh, cancelCh)
+	content := []byte("hello")
 
-	// Create some frames and send them
-	f1 := &StreamFrame{
-		File:   "foo",
-		Offset: 5,
-		Data:   []byte("hello"),
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/readat/"):
+			offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+			if offset >= int64(len(content)) {
+				return
+			}
+			w.Write(content[offset:])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	r, err := client.AllocFS().SeekableReader(alloc, "f", nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = r.Seek(100, io.SeekStart)
+	require.NoError(t, err)
+
+	buf := make([]byte, 10)
+	n, err := r.Read(buf)
+	require.Equal(t, 0, n)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestFS_Cat_DirectoryError_FromNodeErrorText(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			http.Error(w, fmt.Sprintf("file %q is a directory", r.URL.Query().Get("path")), http.StatusBadRequest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	_, err = client.AllocFS().Cat(alloc, "somedir", nil)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrIsDirectory), "got: %v", err)
+}
+
+func TestFS_Cat_DirectoryError_CheckDirectory(t *testing.T) {
+	t.Parallel()
+
+	var catCalled bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/stat/"):
+			b, _ := json.Marshal(&AllocFileInfo{Name: "somedir", IsDir: true})
+			w.Write(b)
+		case strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/"):
+			catCalled = true
+			w.Write([]byte("should not be reached"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	_, err = client.AllocFS().Cat(alloc, "somedir", &QueryOptions{CheckDirectory: true})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrIsDirectory), "got: %v", err)
+	require.False(t, catCalled, "Cat endpoint should not have been hit")
+}
+
+func TestFS_Watch_DebouncesRapidChanges(t *testing.T) {
+	t.Parallel()
+
+	var sizeMu sync.Mutex
+	size := int64(10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sizeMu.Lock()
+		s := size
+		sizeMu.Unlock()
+		b, _ := json.Marshal(&AllocFileInfo{Name: "f", Size: s, ModTime: time.Unix(0, s)})
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	fs := client.AllocFS()
+
+	var timerMu sync.Mutex
+	var timer *fakeTimer
+	fs.setClock(&fakeClockFactory{
+		newTimer: func(d time.Duration) clockTimer {
+			timerMu.Lock()
+			defer timerMu.Unlock()
+			timer = &fakeTimer{c: make(chan time.Time, 1)}
+			return timer
+		},
+	})
+
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	out, err := fs.Watch(alloc, "f", 2*time.Millisecond, time.Second, cancel, nil)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		timerMu.Lock()
+		defer timerMu.Unlock()
+		return timer != nil
+	}, time.Second, time.Millisecond)
+
+	// Drive three rapid changes via the poll ticker (real time, short
+	// interval); each one should re-arm the single fake debounce timer
+	// without emitting, since we never fire it until the last one.
+	for i := 0; i < 3; i++ {
+		sizeMu.Lock()
+		size += 10
+		sizeMu.Unlock()
+		require.Eventually(t, func() bool {
+			timerMu.Lock()
+			defer timerMu.Unlock()
+			return atomic.LoadInt32(&timer.resets) == int32(i+1)
+		}, time.Second, time.Millisecond)
 	}
-	f2 := &StreamFrame{
-		File:   "foo",
-		Offset: 10,
-		Data:   []byte(", wor"),
+
+	select {
+	case <-out:
+		t.Fatal("expected no emission before the debounce timer fires")
+	case <-time.After(20 * time.Millisecond):
 	}
-	f3 := &StreamFrame{
-		File:   "foo",
-		Offset: 12,
-		Data:   []byte("ld"),
+
+	timerMu.Lock()
+	last := timer
+	timerMu.Unlock()
+	last.fire()
+
+	select {
+	case info := <-out:
+		require.Equal(t, int64(40), info.Size)
+	case <-time.After(time.Second):
+		t.Fatal("expected a debounced emission")
 	}
-	framesCh <- f1
-	framesCh <- f2
-	framesCh <- f3
-	close(framesCh)
+}
 
-	expected := []byte("hello, world")
+func TestFS_Watch_EmitsTerminalEventOnDeletion(t *testing.T) {
+	t.Parallel()
 
-	// Read a little
-	p := make([]byte, 12)
+	var deleted atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if deleted.Load() {
+			http.Error(w, "Unexpected response code: 404", http.StatusNotFound)
+			return
+		}
+		b, _ := json.Marshal(&AllocFileInfo{Name: "f", Size: 10, ModTime: time.Unix(0, 1)})
+		w.Write(b)
+	}))
+	defer srv.Close()
 
-	n, err := r.Read(p[:5])
-	if err != nil {
-		t.Fatalf("Read failed: %v", err)
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	fs := client.AllocFS()
+
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	out, err := fs.Watch(alloc, "f", time.Millisecond, time.Millisecond, cancel, nil)
+	require.NoError(t, err)
+
+	select {
+	case info := <-out:
+		require.Equal(t, int64(10), info.Size)
+	case <-time.After(time.Second):
+		t.Fatal("expected initial emission")
 	}
-	if off := r.Offset(); off != n {
-		t.Fatalf("unexpected read bytes: got %v; wanted %v", n, off)
+
+	deleted.Store(true)
+
+	select {
+	case info := <-out:
+		require.Equal(t, int64(0), info.Size)
+	case <-time.After(time.Second):
+		t.Fatal("expected terminal emission on deletion")
 	}
 
-	off := n
+	select {
+	case _, ok := <-out:
+		require.False(t, ok, "channel should close after terminal event")
+	case <-time.After(time.Second):
+		t.Fatal("expected channel to close")
+	}
+}
+
+func TestFS_CatCompressed_PlainNodeResponse(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("hello compressed world")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	r, err := client.AllocFS().CatCompressed(alloc, "f", nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	gz, err := gzip.NewReader(r)
+	require.NoError(t, err)
+	got, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	require.Equal(t, content, got)
+}
+
+func TestFS_CatCompressed_NodeAlreadyGzipped(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("hello from a node that already gzips its responses")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(content)
+		gz.Close()
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	r, err := client.AllocFS().CatCompressed(alloc, "f", nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	gz, err := gzip.NewReader(r)
+	require.NoError(t, err)
+	got, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	require.Equal(t, content, got)
+}
+
+func TestFS_Cat_RequestIDHeaderSentAndEchoed(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("hello request id")
+	var gotHeader string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			http.NotFound(w, r)
+			return
+		}
+		gotHeader = r.Header.Get("X-Nomad-Request-ID")
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	q := &QueryOptions{}
+	r, err := client.AllocFS().Cat(alloc, "f", q)
+	require.NoError(t, err)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, content, got)
+
+	require.NotEmpty(t, gotHeader, "expected X-Nomad-Request-ID header to be sent")
+	require.Equal(t, gotHeader, q.RequestID, "QueryOptions.RequestID should be echoed back to the caller")
+}
+
+func TestFS_Cat_RequestIDHonorsCallerSuppliedValue(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("hello")
+	var gotHeader string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/cat/") {
+			http.NotFound(w, r)
+			return
+		}
+		gotHeader = r.Header.Get("X-Nomad-Request-ID")
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	q := &QueryOptions{RequestID: "caller-chosen-id"}
+	r, err := client.AllocFS().Cat(alloc, "f", q)
+	require.NoError(t, err)
+	defer r.Close()
+	io.ReadAll(r)
+
+	require.Equal(t, "caller-chosen-id", gotHeader)
+	require.Equal(t, "caller-chosen-id", q.RequestID)
+}
+
+func TestFS_ChunkedReader(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("0123456789abcdefghij") // 20 bytes
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			http.NotFound(w, r)
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: content}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	chunks, errCh := client.AllocFS().ChunkedReader(alloc, "f", 6, cancel, nil)
+
+	var got []byte
+	var sizes []int
+loop:
 	for {
-		n, err = r.Read(p[off:])
-		if err != nil {
-			if err == io.EOF {
-				break
+		select {
+		case c, ok := <-chunks:
+			if !ok {
+				break loop
 			}
-			t.Fatalf("Read failed: %v", err)
+			sizes = append(sizes, len(c))
+			got = append(got, c...)
+		case err := <-errCh:
+			t.Fatalf("unexpected error: %v", err)
 		}
-		off += n
 	}
 
-	if !reflect.DeepEqual(p, expected) {
-		t.Fatalf("read %q, wanted %q", string(p), string(expected))
-	}
+	require.Equal(t, content, got)
+	require.Equal(t, []int{6, 6, 6, 2}, sizes)
+}
 
-	if err := r.Close(); err != nil {
-		t.Fatalf("Close() failed: %v", err)
-	}
-	if _, ok := <-cancelCh; ok {
-		t.Fatalf("Close() didn't close cancel channel")
-	}
-	if len(expected) != r.Offset() {
-		t.Fatalf("offset %d, wanted %d", r.Offset(), len(expected))
-	}
+func TestFS_ChunkedReader_InvalidChunkSize(t *testing.T) {
+	t.Parallel()
+
+	client, err := NewClient(DefaultConfig())
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	cancel := make(chan struct{})
+	defer close(cancel)
+
+	chunks, errCh := client.AllocFS().ChunkedReader(alloc, "f", 0, cancel, nil)
+	_, ok := <-chunks
+	require.False(t, ok)
+	require.Error(t, <-errCh)
 }
 
-func TestFS_FrameReader_Unblock(t *testing.T) {
+func TestFS_Cat_ProxyBaseURL(t *testing.T) {
 	t.Parallel()
-	// Create a channel of the frames and a cancel channel
-	framesCh := make(chan *StreamFrame, 3)
-	errCh := make(chan error)
-	cancelCh := make(chan struct{})
 
-	r := NewFrameReader(framesCh, errCh, cancelCh)
-	r.SetUnblockTime(10 * time.Millisecond)
+	content := []byte("proxied content")
+	var gotPath, gotNode, gotFilePath string
 
-	// Read a little
-	p := make([]byte, 12)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotNode = r.URL.Query().Get("node")
+		gotFilePath = r.URL.Query().Get("path")
+		w.Write(content)
+	}))
+	defer proxy.Close()
 
-	n, err := r.Read(p)
-	if err != nil {
-		t.Fatalf("Read failed: %v", err)
-	}
+	// Address points somewhere that would fail if contacted, to prove the
+	// request actually went to the proxy and not through the normal
+	// node-dial path.
+	config := DefaultConfig()
+	config.Address = "http://127.0.0.1:1"
+	config.ProxyBaseURL = proxy.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
 
-	if n != 0 {
-		t.Fatalf("should have unblocked")
-	}
+	alloc := &Allocation{ID: "abc123", NodeID: "node1"}
 
-	// Unset the unblock
-	r.SetUnblockTime(0)
+	r, err := client.AllocFS().Cat(alloc, "f", nil)
+	require.NoError(t, err)
+	defer r.Close()
 
-	resultCh := make(chan struct{})
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, content, got)
+
+	require.Equal(t, "/v1/client/fs/cat/abc123", gotPath)
+	require.Equal(t, "node1", gotNode)
+	require.Equal(t, "f", gotFilePath)
+}
+
+func TestFS_AssertLogMatches_MatchBeforeTimeout(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/logs/") {
+			http.NotFound(w, r)
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("starting up\n")}))
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("listening on :8080\n")}))
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+
+	re := regexp.MustCompile(`listening on`)
+	err = client.AllocFS().AssertLogMatches(alloc, "task", "stdout", re, 5*time.Second, nil)
+	require.NoError(t, err)
+}
+
+func TestFS_AssertLogMatches_TimeoutIncludesContextLines(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/logs/") {
+			http.NotFound(w, r)
+			return
+		}
+		flusher := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("one\n")}))
+		flusher.Flush()
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("two\n")}))
+		flusher.Flush()
+		// Keep the connection alive with heartbeats (which streamJSONFrames
+		// skips without involving the line scanner) until the client
+		// disconnects, so Close below doesn't block on an abandoned
+		// in-flight request.
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			default:
+			}
+			enc.Encode(&StreamFrame{})
+			flusher.Flush()
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.Address = srv.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	fs := client.AllocFS()
+
+	var timerMu sync.Mutex
+	var timer *fakeTimer
+	fs.setClock(&fakeClockFactory{
+		newTimer: func(d time.Duration) clockTimer {
+			timerMu.Lock()
+			defer timerMu.Unlock()
+			timer = &fakeTimer{c: make(chan time.Time, 1)}
+			return timer
+		},
+	})
+
+	re := regexp.MustCompile(`never going to match`)
+	errCh := make(chan error, 1)
 	go func() {
-		r.Read(p)
-		close(resultCh)
+		errCh <- fs.AssertLogMatches(alloc, "task", "stdout", re, time.Second, nil)
 	}()
 
+	require.Eventually(t, func() bool {
+		timerMu.Lock()
+		defer timerMu.Unlock()
+		return timer != nil
+	}, 2*time.Second, time.Millisecond)
+
+	// Give the log lines a moment to be scanned into the "recent" buffer
+	// before firing the timeout.
+	time.Sleep(50 * time.Millisecond)
+
+	timerMu.Lock()
+	timer.fire()
+	timerMu.Unlock()
+
 	select {
-	case <-resultCh:
-		t.Fatalf("shouldn't have unblocked")
-	case <-time.After(300 * time.Millisecond):
+	case err := <-errCh:
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "one")
+		require.Contains(t, err.Error(), "two")
+		require.Contains(t, err.Error(), "never going to match")
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected timeout error")
 	}
 }
 
-func TestFS_FrameReader_Error(t *testing.T) {
+func TestFS_StreamGrep(t *testing.T) {
 	t.Parallel()
-	// Create a channel of the frames and a cancel channel
-	framesCh := make(chan *StreamFrame, 3)
-	errCh := make(chan error, 1)
-	cancelCh := make(chan struct{})
 
-	r := NewFrameReader(framesCh, errCh, cancelCh)
-	r.SetUnblockTime(10 * time.Millisecond)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			http.NotFound(w, r)
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("INFO starting\nERROR boom\nINFO done\n")}))
+	}))
+	defer srv.Close()
 
-	// Send an error
-	expected := fmt.Errorf("test error")
-	errCh <- expected
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
 
-	// Read a little
-	p := make([]byte, 12)
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	re := regexp.MustCompile(`^ERROR`)
 
-	_, err := r.Read(p)
-	if err == nil || !strings.Contains(err.Error(), expected.Error()) {
-		t.Fatalf("bad error: %v", err)
+	cancel := make(chan struct{})
+	lines, errCh := client.AllocFS().StreamGrep(alloc, "log", re, false, cancel, nil)
+
+	var got []string
+loop:
+	for {
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				break loop
+			}
+			got = append(got, l)
+		case err := <-errCh:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	close(cancel)
+
+	require.Equal(t, []string{"ERROR boom"}, got)
+}
+
+func TestFS_StreamGrep_Inverted(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/client/fs/stream/") {
+			http.NotFound(w, r)
+			return
+		}
+		enc := json.NewEncoder(w)
+		require.NoError(t, enc.Encode(&StreamFrame{Data: []byte("INFO starting\nERROR boom\nINFO done\n")}))
+	}))
+	defer srv.Close()
+
+	conf := DefaultConfig()
+	conf.Address = srv.URL
+	client, err := NewClient(conf)
+	require.NoError(t, err)
+
+	alloc := &Allocation{ID: "abc123", NodeID: "unknown"}
+	re := regexp.MustCompile(`^ERROR`)
+
+	cancel := make(chan struct{})
+	lines, errCh := client.AllocFS().StreamGrep(alloc, "log", re, true, cancel, nil)
+
+	var got []string
+loop:
+	for {
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				break loop
+			}
+			got = append(got, l)
+		case err := <-errCh:
+			t.Fatalf("unexpected error: %v", err)
+		}
 	}
+	close(cancel)
+
+	require.Equal(t, []string{"INFO starting", "INFO done"}, got)
 }